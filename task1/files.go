@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+// stdioName is the file name that stands for stdin or stdout
+const stdioName = "-"
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// input is an opened input file, decompressed if needed
+type input struct {
+	io.Reader
+	closers []io.Closer
+	raw     *countingReader
+	size    int64 // size of the file on disk, 0 when unknown
+}
+
+// countingReader counts the bytes read through it. The count may be read
+// from other goroutines.
+type countingReader struct {
+	reader io.Reader
+	count  atomic.Int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.reader.Read(p)
+	cr.count.Add(int64(n))
+	return n, err
+}
+
+// BytesRead returns how many bytes of the file have been read so far,
+// before decompression
+func (in *input) BytesRead() int64 {
+	return in.raw.count.Load()
+}
+
+// Close closes the decompressor and the underlying file
+func (in *input) Close() error {
+	var firstErr error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if err := in.closers[i].Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// openInput opens name for reading, with "-" meaning stdin. Gzip and bzip2
+// compressed inputs are recognized by their magic bytes and decompressed
+// transparently.
+func openInput(name string) (*input, error) {
+	in := &input{}
+
+	in.raw = &countingReader{reader: os.Stdin}
+	if name != stdioName {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open file %s: %w", name, err)
+		}
+		in.raw.reader = file
+		in.closers = append(in.closers, file)
+
+		if info, err := file.Stat(); err == nil && info.Mode().IsRegular() {
+			in.size = info.Size()
+		}
+	}
+
+	buffered := bufio.NewReader(in.raw)
+	magic, _ := buffered.Peek(len(bzip2Magic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			in.Close()
+			return nil, fmt.Errorf("failed to read gzip file %s: %w", name, err)
+		}
+		in.Reader = gz
+		in.closers = append(in.closers, gz)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		in.Reader = bzip2.NewReader(buffered)
+	default:
+		in.Reader = buffered
+	}
+
+	return in, nil
+}
+
+// output is an output file being written. File outputs are written to a
+// temporary file next to the target and only renamed over it by Commit, so
+// a failed or interrupted run never leaves a partial file behind and the
+// output may safely be one of the inputs.
+type output struct {
+	io.Writer
+	gz       *gzip.Writer
+	file     *os.File
+	name     string
+	finished bool
+}
+
+// createOutput starts writing name, with "-" meaning stdout. Names ending in
+// ".gz" are gzip compressed.
+func createOutput(name string) (*output, error) {
+	out := &output{Writer: os.Stdout, name: name}
+
+	if name != stdioName {
+		file, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".tmp-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create file %s: %w", name, err)
+		}
+		out.file = file
+		out.Writer = file
+	}
+
+	if strings.HasSuffix(name, ".gz") {
+		out.gz = gzip.NewWriter(out.Writer)
+		out.Writer = out.gz
+	}
+
+	return out, nil
+}
+
+// Commit finishes the compressed stream, syncs the temporary file to disk
+// and renames it over the target. Stdout is left open.
+func (out *output) Commit() error {
+	if out.finished {
+		return nil
+	}
+
+	if out.gz != nil {
+		if err := out.gz.Close(); err != nil {
+			out.Abort()
+			return fmt.Errorf("failed to write file %s: %w", out.name, err)
+		}
+	}
+
+	if out.file == nil {
+		out.finished = true
+		return nil
+	}
+
+	// Keep the permissions of a file being replaced
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(out.name); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	if err := out.file.Chmod(mode); err != nil {
+		out.Abort()
+		return fmt.Errorf("failed to write file %s: %w", out.name, err)
+	}
+	if err := out.file.Sync(); err != nil {
+		out.Abort()
+		return fmt.Errorf("failed to write file %s: %w", out.name, err)
+	}
+	if err := out.file.Close(); err != nil {
+		out.Abort()
+		return fmt.Errorf("failed to close file %s: %w", out.name, err)
+	}
+	if err := os.Rename(out.file.Name(), out.name); err != nil {
+		out.Abort()
+		return fmt.Errorf("failed to replace file %s: %w", out.name, err)
+	}
+
+	out.finished = true
+	return nil
+}
+
+// Abort discards the temporary file, leaving any existing target untouched.
+// It does nothing after Commit, so it can be deferred.
+func (out *output) Abort() {
+	if out.finished {
+		return
+	}
+	out.finished = true
+
+	if out.file != nil {
+		out.file.Close()
+		os.Remove(out.file.Name())
+	}
+}
+
+// rejectOutput is the reject file of a lenient run. Writes are buffered;
+// Close must be checked to know that every rejected line reached the disk.
+// A nil rejectOutput does nothing, so runs without one need no checks.
+type rejectOutput struct {
+	*bufio.Writer
+	file *os.File
+}
+
+// createRejectOutput creates or truncates the reject file name
+func createRejectOutput(name string) (*rejectOutput, error) {
+	file, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file %s: %w", name, err)
+	}
+	return &rejectOutput{Writer: bufio.NewWriter(file), file: file}, nil
+}
+
+// Close flushes the buffered lines and closes the file
+func (rf *rejectOutput) Close() error {
+	if rf == nil {
+		return nil
+	}
+	err := rf.Flush()
+	if closeErr := rf.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write file %s: %w", rf.file.Name(), err)
+	}
+	return nil
+}
+
+// Remove closes and deletes the file, for runs that were interrupted
+func (rf *rejectOutput) Remove() {
+	if rf == nil {
+		return
+	}
+	rf.file.Close()
+	os.Remove(rf.file.Name())
+}
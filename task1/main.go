@@ -1,98 +1,512 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"sort"
+	"runtime"
 	"strconv"
 	"strings"
+	"time"
+
+	"task1/numsort"
 )
 
 func main() {
-	// Check command line arguments
-	if len(os.Args) != 3 {
-		fmt.Println("Usage: go run main.go <input_file> <output_file>")
-		fmt.Println("Example: go run main.go input.txt output.txt")
+	maxMemory := flag.Int("max-memory", 0, "cap sort memory to this many MiB and spill sorted runs to disk (0 sorts in memory)")
+	tempDir := flag.String("temp-dir", "", "directory for temporary run files (default: system temp directory)")
+	merge := flag.Bool("merge", false, "merge already sorted input files instead of sorting one file")
+	typeName := flag.String("type", "int", "number type: int, int64, float64, bigint or bigfloat")
+	nanPlacement := flag.String("nan", "last", "where NaN values sort: first or last")
+	normalize := flag.Bool("normalize", false, "write numbers in canonical form instead of their original text")
+	inputLocale := flag.String("input-locale", "none", "separators of input numbers: none, en (1,234.5), de (1.234,5), fr (1 234,5) or ch (1'234.5)")
+	currency := flag.Bool("currency", false, "ignore currency symbols and trailing ISO codes such as EUR around input numbers")
+	outputLocale := flag.String("output-locale", "none", "write numbers with the separators of this locale (see -input-locale)")
+	decimals := flag.Int("decimals", -1, "write numbers with this many decimal places (-1 keeps the digits of each value)")
+	pad := flag.Int("pad", 0, "right-align written numbers in fields of this many characters")
+	var keys keyFlags
+	flag.Var(&keys, "k", "sort key FIELD[n][r]: 1-based field, n compares numerically, r descends (repeatable)")
+	delimiter := flag.String("t", "", "field delimiter for -k: any string, \"tab\" or \"csv\" (default: runs of whitespace)")
+	reverse := flag.Bool("r", false, "sort in descending order")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of goroutines used to sort in memory")
+	lenient := flag.Bool("lenient", false, "skip lines that fail to parse instead of aborting")
+	rejectFile := flag.String("reject-file", "", "file receiving the lines skipped by -lenient (default: <output_file>.rejects)")
+	maxRejectRatio := flag.Float64("max-reject-ratio", 0.01, "with -lenient, fail if more than this fraction of lines is rejected")
+	statsFormat := flag.String("stats", "", "print statistics of the sorted numbers: text or json")
+	statsFile := flag.String("stats-file", "", "file receiving the -stats report (default: stdout, or stderr when the sorted output goes to stdout)")
+	statsOnly := flag.Bool("stats-only", false, "print -stats instead of writing sorted output; takes only <input_file>")
+	percentileList := flag.String("percentiles", "25,50,75,90,99", "comma separated percentiles included in -stats")
+	buckets := flag.Int("buckets", 10, "number of histogram buckets in -stats (0 disables the histogram)")
+	unique := flag.Bool("unique", false, "write only the first of each run of equal values")
+	count := flag.Bool("count", false, "write each distinct value followed by how often it occurs")
+	dups := flag.Bool("dups", false, "write only values that occur more than once, one copy each")
+	top := flag.Int("top", 0, "write only the K largest values, largest first, selected in one pass without a full sort")
+	bottom := flag.Int("bottom", 0, "write only the K smallest values, smallest first, selected in one pass without a full sort")
+	inputFormat := flag.String("input-format", "text", "input format: text (one value per line) or binary (packed integers)")
+	outputFormat := flag.String("output-format", "text", "output format: text or binary")
+	bits := flag.Int("bits", 64, "width of binary integers: 32 or 64")
+	endian := flag.String("endian", "little", "byte order of binary integers: little or big")
+	showProgress := flag.Bool("progress", false, "periodically report progress (phase, bytes read, lines parsed, ETA) on stderr")
+	progressInterval := flag.Duration("progress-interval", 2*time.Second, "time between -progress reports")
+	check := flag.Bool("check", false, "only verify that <input_file> is sorted (and unique with -unique); exits 1 at the first violation")
+	flag.Usage = usage
+	flag.Parse()
+
+	typ, err := numsort.ParseType(*typeName)
+	if err != nil {
+		log.Fatalf("Invalid -type: %v", err)
+	}
+	if *nanPlacement != "first" && *nanPlacement != "last" {
+		log.Fatalf("Invalid -nan %q: must be first or last", *nanPlacement)
+	}
+
+	opts := numsort.Options{
+		Type:      typ,
+		NaNFirst:  *nanPlacement == "first",
+		Normalize: *normalize,
+		Keys:      keys,
+		Delimiter: *delimiter,
+		Workers:   *workers,
+		MaxMemory: int64(*maxMemory) << 20,
+		TempDir:   *tempDir,
+	}
+	if *reverse {
+		opts.Order = numsort.Descending
+	}
+
+	// Locales read and write grouped numbers with decimal commas
+	if opts.InputLocale, err = numsort.ParseLocale(*inputLocale); err != nil {
+		log.Fatalf("Invalid -input-locale: %v", err)
+	}
+	opts.StripCurrency = *currency
+	outLocale, err := numsort.ParseLocale(*outputLocale)
+	if err != nil {
+		log.Fatalf("Invalid -output-locale: %v", err)
+	}
+	if *pad < 0 {
+		log.Fatalf("Invalid -pad %d: must not be negative", *pad)
+	}
+	if *outputLocale != "none" || *decimals >= 0 || *pad > 0 {
+		opts.Output = &numsort.OutputStyle{Locale: outLocale, Decimals: *decimals, Pad: *pad}
+	}
+
+	// Binary formats read and write packed integers instead of lines
+	if opts.InputFormat, err = numsort.ParseFormat(*inputFormat); err != nil {
+		log.Fatalf("Invalid -input-format: %v", err)
+	}
+	if opts.OutputFormat, err = numsort.ParseFormat(*outputFormat); err != nil {
+		log.Fatalf("Invalid -output-format: %v", err)
+	}
+	if *bits != 32 && *bits != 64 {
+		log.Fatalf("Invalid -bits %d: must be 32 or 64", *bits)
+	}
+	if opts.ByteOrder, err = numsort.ParseByteOrder(*endian); err != nil {
+		log.Fatalf("Invalid -endian: %v", err)
+	}
+	opts.Bits = *bits
+	if opts.Delimiter == "tab" {
+		opts.Delimiter = "\t"
+	}
+
+	// Statistics are computed over the sorted data held in memory
+	if *statsOnly && *statsFormat == "" {
+		*statsFormat = "text"
+	}
+	if *statsFormat != "" && *statsFormat != "text" && *statsFormat != "json" {
+		log.Fatalf("Invalid -stats %q: must be text or json", *statsFormat)
+	}
+	if *statsFormat != "" && (*merge || *maxMemory > 0) {
+		log.Fatal("-stats needs an in-memory sort and cannot be combined with -merge or -max-memory")
+	}
+	percentiles, err := parsePercentiles(*percentileList)
+	if err != nil {
+		log.Fatalf("Invalid -percentiles: %v", err)
+	}
+	if *statsFormat != "" {
+		opts.Stats = &numsort.StatsOptions{Percentiles: percentiles, Buckets: *buckets}
+	}
+
+	// Top and bottom selection keep a bounded heap instead of sorting
+	switch {
+	case *top < 0 || *bottom < 0:
+		log.Fatal("Invalid -top or -bottom: must not be negative")
+	case *top > 0 && *bottom > 0:
+		log.Fatal("Only one of -top and -bottom can be used")
+	case *top > 0 || *bottom > 0:
+		if *reverse {
+			log.Fatal("-top and -bottom set the order and cannot be combined with -r")
+		}
+		if *merge || *check || *statsFormat != "" {
+			log.Fatal("-top and -bottom cannot be combined with -merge, -check or -stats")
+		}
+		if *unique || *count || *dups {
+			log.Fatal("-top and -bottom cannot be combined with -unique, -count or -dups")
+		}
+		opts.Limit = max(*top, *bottom)
+		if *top > 0 {
+			opts.Order = numsort.Descending
+		}
+	}
+
+	// Check command line arguments. Merge mode takes any number of sorted
+	// inputs followed by the output; -stats-only and -check take no output.
+	var inputFiles []string
+	var outputFile string
+	switch {
+	case (*statsOnly || *check) && flag.NArg() == 1:
+		inputFiles = flag.Args()
+	case *merge && flag.NArg() >= 2, !*statsOnly && !*check && flag.NArg() == 2:
+		inputFiles = flag.Args()[:flag.NArg()-1]
+		outputFile = flag.Arg(flag.NArg() - 1)
+	default:
+		usage()
 		os.Exit(1)
 	}
+	opts.Name = inputFiles[0]
+	if *statsFormat != "" && outputFile == stdioName && *statsFile == stdioName {
+		log.Fatal("-stats-file - cannot share stdout with the sorted output")
+	}
+
+	if *maxMemory < 0 {
+		log.Fatalf("Invalid -max-memory %d: must not be negative", *maxMemory)
+	}
+	if *workers < 1 {
+		log.Fatalf("Invalid -workers %d: must be at least 1", *workers)
+	}
+
+	// Deduplication modes collapse runs of equal values on output
+	switch {
+	case *unique && !*count && !*dups:
+		opts.Dedup = numsort.Unique
+	case *count && !*unique && !*dups:
+		opts.Dedup = numsort.Count
+	case *dups && !*unique && !*count:
+		opts.Dedup = numsort.Duplicates
+	case *unique || *count || *dups:
+		log.Fatal("Only one of -unique, -count and -dups can be used")
+	}
+
+	if *progressInterval <= 0 {
+		log.Fatalf("Invalid -progress-interval %v: must be positive", *progressInterval)
+	}
+
+	// Open every input up front so progress can follow the bytes read
+	inputs := make([]*input, len(inputFiles))
+	for i, name := range inputFiles {
+		in, err := openInput(name)
+		if err != nil {
+			log.Fatalf("Error opening input: %v", err)
+		}
+		defer in.Close()
+		inputs[i] = in
+	}
+
+	// Lenient mode logs unparsable lines instead of aborting. The reject file
+	// is buffered, so every exit from here on closes it first, or removes it
+	// when the run is interrupted.
+	var rejectPath string
+	var rejects *rejectOutput
+	if *lenient {
+		if *maxRejectRatio < 0 || *maxRejectRatio > 1 {
+			log.Fatalf("Invalid -max-reject-ratio %g: must be between 0 and 1", *maxRejectRatio)
+		}
+		if *rejectFile == "" {
+			*rejectFile = defaultRejectFile(inputFiles[0], outputFile)
+		}
+
+		var err error
+		rejects, err = createRejectOutput(*rejectFile)
+		if err != nil {
+			log.Fatalf("Error creating reject file: %v", err)
+		}
+
+		opts.Lenient = true
+		opts.Rejects = rejects
+		opts.MaxRejectRatio = *maxRejectRatio
+		rejectPath = *rejectFile
+	}
+
+	fatalf := func(format string, args ...any) {
+		if err := rejects.Close(); err != nil {
+			log.Printf("Error writing reject file: %v", err)
+		}
+		log.Fatalf(format, args...)
+	}
+	closeRejects := func() {
+		if err := rejects.Close(); err != nil {
+			log.Fatalf("Error writing reject file: %v", err)
+		}
+	}
+
+	// SIGINT and SIGTERM stop the run, which removes its partial output and
+	// temporary files before exiting
+	interrupts := handleInterrupts()
+	ctx := interrupts.ctx
+	exitIfInterrupted := func() {
+		if ctx.Err() != nil {
+			rejects.Remove()
+			interrupts.exitIfInterrupted()
+		}
+	}
 
-	inputFile := os.Args[1]
-	outputFile := os.Args[2]
+	var reporter *progressReporter
+	if *showProgress {
+		opts.Progress = &numsort.Progress{}
+		reporter = startProgress(opts.Progress, inputs, *progressInterval)
+	}
+
+	if *check {
+		result, err := numsort.CheckContext(ctx, inputs[0], opts)
+		reporter.Stop()
+		exitIfInterrupted()
+		var orderErr *numsort.OrderError
+		if errors.As(err, &orderErr) {
+			closeRejects()
+			fmt.Fprintln(os.Stderr, orderErr)
+			os.Exit(1)
+		}
+		if err != nil {
+			fatalf("Error checking file: %v", explainRejects(err, rejectPath))
+		}
+		closeRejects()
+
+		order := "sorted"
+		if *unique {
+			order = "sorted and unique"
+		}
+		fmt.Printf("%s is %s (%d numbers checked)%s\n", inputFiles[0], order, result.Records, rejectSummary(result, rejectPath))
+		return
+	}
+
+	// Keep stdout clean for the sorted data when it is written there
+	status := os.Stdout
+	if outputFile == stdioName {
+		status = os.Stderr
+	}
+
+	if *merge {
+		result, err := mergeFiles(ctx, inputs, inputFiles, outputFile, opts)
+		reporter.Stop()
+		if err != nil {
+			exitIfInterrupted()
+			fatalf("Error merging files: %v", explainRejects(err, rejectPath))
+		}
+		closeRejects()
+
+		fmt.Fprintf(status, "Successfully merged %d numbers from %d files to %s%s%s\n",
+			result.Records, len(inputFiles), outputFile, dedupSummary(opts.Dedup, result.Written), rejectSummary(result, rejectPath))
+		return
+	}
+
+	inputFile := inputFiles[0]
 
-	// Read numbers from input file
-	numbers, err := readNumbersFromFile(inputFile)
+	if *statsOnly {
+		outputFile = ""
+	}
+	result, err := sortFile(ctx, inputs[0], outputFile, opts)
+	reporter.Stop()
 	if err != nil {
-		log.Fatalf("Error reading input file: %v", err)
+		exitIfInterrupted()
+		fatalf("Error sorting file: %v", explainRejects(err, rejectPath))
+	}
+	closeRejects()
+
+	if result.Stats != nil {
+		if err := writeStatsFile(*statsFile, *statsFormat, *result.Stats, status); err != nil {
+			log.Fatalf("Error writing statistics: %v", err)
+		}
+	}
+
+	if *statsOnly {
+		return
+	}
+
+	if opts.Limit > 0 {
+		fmt.Fprintf(status, "Successfully selected %d of %d numbers from %s to %s%s\n",
+			result.Written, result.Records, inputFile, outputFile, rejectSummary(result, rejectPath))
+		return
+	}
+
+	fmt.Fprintf(status, "Successfully sorted %d numbers from %s to %s%s%s\n",
+		result.Records, inputFile, outputFile, dedupSummary(opts.Dedup, result.Written), rejectSummary(result, rejectPath))
+}
+
+// defaultRejectFile names the reject file after the output, or after the
+// input when the output is stdout or missing
+func defaultRejectFile(inputFile, outputFile string) string {
+	switch {
+	case outputFile != "" && outputFile != stdioName:
+		return outputFile + ".rejects"
+	case inputFile != stdioName:
+		return inputFile + ".rejects"
+	default:
+		return "stdin.rejects"
+	}
+}
+
+// usage prints the command line help
+func usage() {
+	fmt.Println("Usage: go run main.go [flags] <input_file> <output_file>")
+	fmt.Println("       go run main.go -merge <sorted_file>... <output_file>")
+	fmt.Println("       go run main.go -stats-only <input_file>")
+	fmt.Println("       go run main.go -check [-unique] <input_file>")
+	fmt.Println("Example: go run main.go input.txt output.txt")
+	fmt.Println("Example: go run main.go -max-memory 512 huge.txt sorted.txt")
+	fmt.Println("Example: go run main.go -merge shard1.txt shard2.txt merged.txt")
+	fmt.Println("Example: go run main.go -type bigfloat -normalize mixed.txt sorted.txt")
+	fmt.Println("Example: go run main.go -t csv -k 3 -k 2nr data.csv sorted.csv")
+	fmt.Println("Example: go run main.go -lenient -max-reject-ratio 0.05 dirty.txt sorted.txt")
+	fmt.Println("Example: go run main.go -stats json -stats-file stats.json input.txt output.txt")
+	fmt.Println("Example: go run main.go -stats-only -percentiles 50,99 -buckets 20 input.txt")
+	fmt.Println("Example: go run main.go -count -max-memory 512 ids.txt id_counts.txt")
+	fmt.Println("Example: zcat dump.gz | go run main.go - - | head")
+	fmt.Println("Example: go run main.go -check -unique -r release.txt")
+	fmt.Println("Example: go run main.go -top 100 latencies.txt slowest.txt")
+	fmt.Println("Example: go run main.go -progress -max-memory 1024 huge.txt sorted.txt")
+	fmt.Println("Example: go run main.go -type float64 -input-locale de -currency -output-locale en -decimals 2 -pad 15 ledger.txt sorted.txt")
+	fmt.Println("Example: go run main.go -input-format binary -bits 32 -output-format text telemetry.bin sorted.txt")
+	fmt.Println("\nUse - for stdin or stdout. Gzip and bzip2 inputs are decompressed automatically;")
+	fmt.Println("outputs ending in .gz are gzip compressed. On SIGINT or SIGTERM partial output and")
+	fmt.Println("temporary files are removed and the exit code is 128 plus the signal number.")
+	fmt.Println("\nFlags:")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.PrintDefaults()
+}
+
+// sortFile sorts in into outputFile, replacing it only once the sort has
+// succeeded. An empty outputFile discards the sorted data.
+func sortFile(ctx context.Context, in *input, outputFile string, opts numsort.Options) (numsort.Result, error) {
+	if outputFile == "" {
+		return numsort.SortContext(ctx, in, nil, opts)
 	}
 
-	// Sort numbers in ascending order
-	sort.Ints(numbers)
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return numsort.Result{}, err
+	}
+	defer out.Abort()
 
-	// Write sorted numbers to output file
-	err = writeNumbersToFile(outputFile, numbers)
+	result, err := numsort.SortContext(ctx, in, out, opts)
 	if err != nil {
-		log.Fatalf("Error writing output file: %v", err)
+		return result, err
 	}
 
-	fmt.Printf("Successfully sorted %d numbers from %s to %s\n", len(numbers), inputFile, outputFile)
+	return result, out.Commit()
 }
 
-// readNumbersFromFile reads integers from a file, one per line
-func readNumbersFromFile(filename string) ([]int, error) {
-	file, err := os.Open(filename)
+// mergeFiles merges sorted inputs, opened from the named files, into
+// outputFile
+func mergeFiles(ctx context.Context, inputs []*input, names []string, outputFile string, opts numsort.Options) (numsort.Result, error) {
+	sources := make([]numsort.Input, len(inputs))
+	for i, in := range inputs {
+		sources[i] = numsort.Input{Name: names[i], Reader: in}
+	}
+
+	out, err := createOutput(outputFile)
+	if err != nil {
+		return numsort.Result{}, err
+	}
+	defer out.Abort()
+
+	result, err := numsort.MergeContext(ctx, sources, out, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file %s: %w", filename, err)
+		return result, err
 	}
-	defer file.Close()
 
-	var numbers []int
-	scanner := bufio.NewScanner(file)
+	return result, out.Commit()
+}
+
+// keyFlags collects repeated -k flags
+type keyFlags []numsort.Key
 
-	lineNumber := 0
-	for scanner.Scan() {
-		lineNumber++
-		line := strings.TrimSpace(scanner.Text())
+func (k *keyFlags) String() string {
+	return fmt.Sprint(len(*k), " keys")
+}
 
-		// Skip empty lines
-		if line == "" {
+func (k *keyFlags) Set(value string) error {
+	key, err := numsort.ParseKey(value)
+	if err != nil {
+		return err
+	}
+	*k = append(*k, key)
+	return nil
+}
+
+// parsePercentiles parses a comma separated -percentiles value
+func parsePercentiles(value string) ([]float64, error) {
+	var ps []float64
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
 			continue
 		}
 
-		// Convert string to integer
-		num, err := strconv.Atoi(line)
-		if err != nil {
-			return nil, fmt.Errorf("invalid number '%s' on line %d: %w", line, lineNumber, err)
+		p, err := strconv.ParseFloat(field, 64)
+		if err != nil || p < 0 || p > 100 {
+			return nil, fmt.Errorf("invalid percentile %q: must be a number between 0 and 100", field)
 		}
+		ps = append(ps, p)
+	}
+	return ps, nil
+}
 
-		numbers = append(numbers, num)
+// rejectSummary describes the lines rejected in lenient mode for the success
+// message
+func rejectSummary(result numsort.Result, rejectPath string) string {
+	if rejectPath == "" {
+		return ""
 	}
+	return fmt.Sprintf(" (%d lines rejected, see %s)", result.Rejected, rejectPath)
+}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading file: %w", err)
+// explainRejects points an exceeded error budget at the reject file
+func explainRejects(err error, rejectPath string) error {
+	if errors.Is(err, numsort.ErrTooManyRejects) {
+		return fmt.Errorf("%w; see %s", err, rejectPath)
 	}
+	return err
+}
 
-	return numbers, nil
+// dedupSummary describes the lines written in a dedup mode for the success
+// message
+func dedupSummary(mode numsort.Dedup, written int) string {
+	switch mode {
+	case numsort.Unique:
+		return fmt.Sprintf(" (%d unique values written)", written)
+	case numsort.Count:
+		return fmt.Sprintf(" (%d value counts written)", written)
+	case numsort.Duplicates:
+		return fmt.Sprintf(" (%d duplicated values written)", written)
+	default:
+		return ""
+	}
 }
 
-// writeNumbersToFile writes integers to a file, one per line
-func writeNumbersToFile(filename string, numbers []int) error {
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", filename, err)
+// writeStatsFile writes stats in the given format ("text" or "json") to
+// filename, "-" for stdout, or to w when filename is empty
+func writeStatsFile(filename, format string, stats numsort.Stats, w io.Writer) error {
+	write := numsort.WriteStatsText
+	if format == "json" {
+		write = numsort.WriteStatsJSON
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	defer writer.Flush()
+	if filename == "" {
+		return write(w, stats)
+	}
 
-	for _, num := range numbers {
-		_, err := fmt.Fprintf(writer, "%d\n", num)
-		if err != nil {
-			return fmt.Errorf("failed to write number %d: %w", num, err)
-		}
+	file, err := createOutput(filename)
+	if err != nil {
+		return err
 	}
+	defer file.Abort()
 
-	return nil
+	if err := write(file, stats); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", filename, err)
+	}
+
+	return file.Commit()
 }
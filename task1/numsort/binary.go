@@ -0,0 +1,146 @@
+package numsort
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Format is how values are stored in an input or output
+type Format int
+
+const (
+	TextFormat   Format = iota // one value or delimited record per line
+	BinaryFormat               // packed fixed-width two's complement integers
+)
+
+var formatNames = map[string]Format{
+	"text":   TextFormat,
+	"binary": BinaryFormat,
+}
+
+// ParseFormat converts a format name, "text" or "binary", into a Format
+func ParseFormat(name string) (Format, error) {
+	format, ok := formatNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown format %q (want text or binary)", name)
+	}
+	return format, nil
+}
+
+// ParseByteOrder converts an endianness name, "little" or "big", into a byte
+// order
+func ParseByteOrder(name string) (binary.ByteOrder, error) {
+	switch name {
+	case "little":
+		return binary.LittleEndian, nil
+	case "big":
+		return binary.BigEndian, nil
+	default:
+		return nil, fmt.Errorf("unknown byte order %q (want little or big)", name)
+	}
+}
+
+// binaryLayout describes packed binary integers
+type binaryLayout struct {
+	size  int // bytes per value, 4 or 8
+	order binary.ByteOrder
+}
+
+// recordSource yields the records of one input in input order
+type recordSource interface {
+	Next() (record, error)
+
+	// Position returns the 1-based line or value number of the last record
+	Position() int
+}
+
+// Position returns the number of the last line read
+func (rr *recordReader) Position() int {
+	return rr.lineNumber
+}
+
+// newSource creates a record source reading the named input in the input
+// format of opts
+func (opts *sortOptions) newSource(r io.Reader, name string) recordSource {
+	var source recordSource
+	if opts.input == BinaryFormat {
+		source = newBinaryReader(r, opts.layout)
+	} else {
+		reader := newRecordReader(r, opts.format)
+		reader.name = name
+		reader.rejects = opts.rejects
+		source = reader
+	}
+
+	return &trackedSource{recordSource: source, ctx: opts.ctx, progress: opts.progress}
+}
+
+// binaryReader reads packed binary integers as bare number records
+type binaryReader struct {
+	reader *bufio.Reader
+	layout binaryLayout
+	buf    [8]byte
+	count  int
+}
+
+// newBinaryReader creates a binary reader over r
+func newBinaryReader(r io.Reader, layout binaryLayout) *binaryReader {
+	return &binaryReader{reader: bufio.NewReader(r), layout: layout}
+}
+
+// Next returns the next value as a record, or io.EOF once the input is
+// exhausted
+func (br *binaryReader) Next() (record, error) {
+	buf := br.buf[:br.layout.size]
+	if _, err := io.ReadFull(br.reader, buf); err != nil {
+		if err == io.EOF {
+			return record{}, io.EOF
+		}
+		if err == io.ErrUnexpectedEOF {
+			return record{}, fmt.Errorf("truncated value %d: input length is not a multiple of %d bytes", br.count+1, br.layout.size)
+		}
+		return record{}, fmt.Errorf("error reading file: %w", err)
+	}
+	br.count++
+
+	var value int64
+	if br.layout.size == 4 {
+		value = int64(int32(br.layout.order.Uint32(buf)))
+	} else {
+		value = int64(br.layout.order.Uint64(buf))
+	}
+
+	text := strconv.FormatInt(value, 10)
+	return record{line: text, keys: []number{{text: text, i: value}}}, nil
+}
+
+// Position returns the number of the last value read
+func (br *binaryReader) Position() int {
+	return br.count
+}
+
+// errBinaryCount is returned when value counts are to be written in binary
+var errBinaryCount = errors.New("value counts cannot be written in binary")
+
+// writeBinary writes the integer key of r to w in the given layout
+func writeBinary(w *bufio.Writer, r record, layout binaryLayout) error {
+	var buf [8]byte
+	value := r.keys[0].i
+
+	if layout.size == 4 {
+		if value < math.MinInt32 || value > math.MaxInt32 {
+			return errors.New("out of range for 32-bit output")
+		}
+		layout.order.PutUint32(buf[:4], uint32(int32(value)))
+	} else {
+		layout.order.PutUint64(buf[:8], uint64(value))
+	}
+
+	_, err := w.Write(buf[:layout.size])
+	return err
+}
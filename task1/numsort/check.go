@@ -0,0 +1,63 @@
+package numsort
+
+import (
+	"fmt"
+	"io"
+)
+
+// OrderError reports a line that breaks the sort order of a sorted input,
+// or repeats the previous value when the input must be unique
+type OrderError struct {
+	Name      string // input name
+	Line      int    // 1-based line number of Value, or its value number in binary inputs
+	Previous  string // line preceding Value
+	Value     string // offending line
+	Duplicate bool   // Value equals Previous rather than sorting before it
+}
+
+func (e *OrderError) Error() string {
+	if e.Duplicate {
+		return fmt.Sprintf("%s is not unique: line %d repeats %s", e.Name, e.Line, e.Value)
+	}
+	return fmt.Sprintf("%s is not sorted: line %d has %s after %s", e.Name, e.Line, e.Value, e.Previous)
+}
+
+// checkOrder returns an *OrderError if current, read from the given line of
+// the named input, may not follow previous
+func checkOrder(rf *recordFormat, previous, current record, name string, line int, unique bool) error {
+	c := rf.compare(current, previous)
+	if c < 0 || (unique && c == 0) {
+		return &OrderError{Name: name, Line: line, Previous: previous.line, Value: current.line, Duplicate: c == 0}
+	}
+	return nil
+}
+
+// checkSorted streams r and fails with an *OrderError at the first record
+// that is out of order, or that repeats its predecessor when unique is set.
+// It returns the number of records checked.
+func checkSorted(r io.Reader, opts sortOptions, unique bool) (int, error) {
+	source := opts.newSource(r, opts.name)
+
+	var previous record
+	count := 0
+	for {
+		rec, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+
+		if count > 0 {
+			if err := checkOrder(&opts.format, previous, rec, opts.name, source.Position(), unique); err != nil {
+				return count, err
+			}
+		}
+
+		previous = rec
+		count++
+	}
+
+	return count, nil
+}
@@ -0,0 +1,210 @@
+package numsort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"unsafe"
+)
+
+// runBufferSize is the read buffer held for every open run during a merge
+const runBufferSize = 64 * 1024
+
+var (
+	// recordSize and numberSize estimate the memory held by a parsed record
+	// and each of its keys, excluding text and big.Int/big.Float digits
+	recordSize = int64(unsafe.Sizeof(record{}))
+	numberSize = int64(unsafe.Sizeof(number{}))
+)
+
+// memoryFor estimates the memory held by r while it waits in a chunk
+func memoryFor(r record) int64 {
+	size := recordSize + int64(len(r.line))
+	for _, key := range r.keys {
+		size += numberSize
+		if key.b != nil {
+			size += int64(len(key.b.Bits())) * 8
+		}
+		if key.bf != nil {
+			size += bigFloatPrec / 8
+		}
+	}
+	return size
+}
+
+// externalSort sorts r into w while holding at most opts.maxBytes of parsed
+// records in memory. Chunks are sorted with up to opts.workers goroutines,
+// spilled to temporary run files under opts.tempDir and k-way merged into w.
+// The run files are removed whether or not the sort succeeds. The error
+// budget of opts.rejects is checked before the runs are merged. It returns
+// the number of records read and lines written.
+func externalSort(r io.Reader, w io.Writer, opts sortOptions) (int, int, error) {
+	runDir, err := os.MkdirTemp(opts.tempDir, "numsort-runs-")
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(runDir)
+
+	// Runs always keep every original line as text so the final merge can
+	// normalize, deduplicate and encode them
+	runOpts := sortOptions{format: opts.format, ctx: opts.ctx, progress: opts.progress}
+	runOpts.format.numbers.normalize = false
+	runOpts.format.numbers.style = nil
+
+	// Split the input into sorted runs
+	source := opts.newSource(r, opts.name)
+	var chunk []record
+	var chunkBytes int64
+	var runs []string
+	count := 0
+
+	for {
+		rec, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+
+		chunk = append(chunk, rec)
+		chunkBytes += memoryFor(rec)
+		count++
+
+		if chunkBytes >= opts.maxBytes {
+			run, err := writeRun(runDir, chunk, opts)
+			if err != nil {
+				return 0, 0, err
+			}
+			runs = append(runs, run)
+			clear(chunk)
+			chunk = chunk[:0]
+			chunkBytes = 0
+		}
+	}
+
+	if len(chunk) > 0 {
+		run, err := writeRun(runDir, chunk, opts)
+		if err != nil {
+			return 0, 0, err
+		}
+		runs = append(runs, run)
+	}
+	chunk = nil
+
+	if err := opts.rejects.check(count); err != nil {
+		return 0, 0, err
+	}
+
+	// Merge the runs, in several passes if there are too many to keep open.
+	// Each pass merges neighbouring runs so equal values keep input order.
+	fanIn := max(2, int(opts.maxBytes/runBufferSize))
+	for len(runs) > fanIn {
+		opts.progress.start(PhaseMerge, count)
+		var merged []string
+		for start := 0; start < len(runs); start += fanIn {
+			group := runs[start:min(start+fanIn, len(runs))]
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+
+			run, err := mergeRunsToRun(runDir, group, runOpts)
+			if err != nil {
+				return 0, 0, err
+			}
+			merged = append(merged, run)
+		}
+		runs = merged
+	}
+
+	finalOpts := opts
+	finalOpts.rejects = nil
+	finalOpts.input = TextFormat
+	opts.progress.start(PhaseMerge, count)
+	_, written, err := mergeRunFiles(w, runs, finalOpts)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return count, written, nil
+}
+
+// writeRun sorts chunk and writes the original lines of its records to a new
+// run file in dir
+func writeRun(dir string, chunk []record, opts sortOptions) (string, error) {
+	chunk, err := sortRecords(opts.ctx, chunk, opts.format, opts.workers)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp(dir, "run-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create run file: %w", err)
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	for _, r := range chunk {
+		if err := writeLine(writer, r.line); err != nil {
+			return "", fmt.Errorf("failed to write run file %s: %w", file.Name(), err)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return "", fmt.Errorf("failed to write run file %s: %w", file.Name(), err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close run file %s: %w", file.Name(), err)
+	}
+
+	return file.Name(), nil
+}
+
+// mergeRunsToRun merges runs into a new run file in dir and removes the inputs
+func mergeRunsToRun(dir string, runs []string, opts sortOptions) (string, error) {
+	file, err := os.CreateTemp(dir, "run-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create run file: %w", err)
+	}
+	defer file.Close()
+
+	if _, _, err := mergeRunFiles(file, runs, opts); err != nil {
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to close run file %s: %w", file.Name(), err)
+	}
+
+	for _, run := range runs {
+		os.Remove(run)
+	}
+
+	return file.Name(), nil
+}
+
+// mergeRunFiles merges the run files into w. It returns the number of
+// records read and lines written.
+func mergeRunFiles(w io.Writer, runs []string, opts sortOptions) (int, int, error) {
+	inputs := make([]Input, 0, len(runs))
+	for _, run := range runs {
+		file, err := os.Open(run)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to open run file: %w", err)
+		}
+		defer file.Close()
+
+		inputs = append(inputs, Input{Name: run, Reader: file})
+	}
+
+	return mergeInputs(w, inputs, opts)
+}
+
+// writeLine writes text followed by a newline
+func writeLine(w *bufio.Writer, text string) error {
+	if _, err := w.WriteString(text); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
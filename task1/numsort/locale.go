@@ -0,0 +1,245 @@
+package numsort
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Locale holds the separators used to write numbers, e.g. Grouping '.' and
+// Decimal ',' for "1.234.567,89". The zero value is plain Go syntax: no
+// grouping and a decimal point.
+type Locale struct {
+	Grouping rune // thousands separator, 0 for none; ' ' matches any space
+	Decimal  rune // decimal separator, 0 for '.'
+}
+
+var locales = map[string]Locale{
+	"none": {},
+	"en":   {Grouping: ',', Decimal: '.'},
+	"de":   {Grouping: '.', Decimal: ','},
+	"fr":   {Grouping: ' ', Decimal: ','},
+	"ch":   {Grouping: '\'', Decimal: '.'},
+}
+
+// ParseLocale converts a locale name into its separators: "none", "en"
+// (1,234.5), "de" (1.234,5), "fr" (1 234,5) or "ch" (1'234.5)
+func ParseLocale(name string) (Locale, error) {
+	locale, ok := locales[name]
+	if !ok {
+		return Locale{}, fmt.Errorf("unknown locale %q (want none, en, de, fr or ch)", name)
+	}
+	return locale, nil
+}
+
+// decimal returns the decimal separator of l
+func (l Locale) decimal() rune {
+	if l.Decimal == 0 {
+		return '.'
+	}
+	return l.Decimal
+}
+
+// validate checks that the separators of l can be told apart from each
+// other and from digits
+func (l Locale) validate() error {
+	if l.Grouping == l.decimal() {
+		return fmt.Errorf("thousands and decimal separators are both %q", l.Grouping)
+	}
+	for _, r := range []rune{l.Grouping, l.decimal()} {
+		if (r >= '0' && r <= '9') || r == '+' || r == '-' {
+			return fmt.Errorf("%q cannot be a separator", r)
+		}
+	}
+	return nil
+}
+
+// isGrouping reports whether r is the thousands separator of l
+func (l Locale) isGrouping(r rune) bool {
+	if l.Grouping == ' ' {
+		return unicode.IsSpace(r) || unicode.Is(unicode.Zs, r)
+	}
+	return l.Grouping != 0 && r == l.Grouping
+}
+
+var errGrouping = errors.New("invalid digit grouping")
+
+// delocalize rewrites text written in l into plain Go syntax. Thousands
+// separators must split the integer digits into groups of three, so a
+// number written in another locale is rejected rather than misread. Hex
+// literals are returned unchanged.
+func (l Locale) delocalize(text string) (string, error) {
+	if l == (Locale{}) {
+		return text, nil
+	}
+	if _, isHex := cutHexPrefix(text); isHex {
+		return text, nil
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+
+	inInteger := true // still in the integer digits, where grouping is allowed
+	grouped := false  // a thousands separator has been seen
+	group := 0        // digits since the last separator
+
+	// endInteger checks the last group of integer digits
+	endInteger := func() error {
+		inInteger = false
+		if grouped && group != 3 {
+			return errGrouping
+		}
+		return nil
+	}
+
+	for _, r := range text {
+		switch {
+		case inInteger && l.isGrouping(r):
+			if group == 0 || (grouped && group != 3) || group > 3 {
+				return "", errGrouping
+			}
+			grouped = true
+			group = 0
+			continue
+		case inInteger && r >= '0' && r <= '9':
+			group++
+		case r == l.decimal():
+			if !inInteger {
+				return "", fmt.Errorf("unexpected %q", r)
+			}
+			if err := endInteger(); err != nil {
+				return "", err
+			}
+			r = '.'
+		case r == '.':
+			return "", fmt.Errorf("unexpected %q", r)
+		case inInteger && (r == '+' || r == '-') && group == 0 && !grouped:
+			// Leading sign
+		case inInteger:
+			if err := endInteger(); err != nil {
+				return "", err
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	if inInteger {
+		if err := endInteger(); err != nil {
+			return "", err
+		}
+	}
+
+	return b.String(), nil
+}
+
+// stripCurrency removes a currency symbol before the number, and a currency
+// symbol or three-letter ISO 4217 code such as "EUR" after it, along with
+// any spaces between them and the number
+func stripCurrency(text string) string {
+	sign := ""
+	if text != "" && (text[0] == '+' || text[0] == '-') {
+		sign, text = text[:1], text[1:]
+	}
+
+	if r, size := utf8.DecodeRuneInString(text); unicode.Is(unicode.Sc, r) {
+		text = strings.TrimLeftFunc(text[size:], unicode.IsSpace)
+	}
+
+	if r, size := utf8.DecodeLastRuneInString(text); unicode.Is(unicode.Sc, r) {
+		text = strings.TrimRightFunc(text[:len(text)-size], unicode.IsSpace)
+	} else if n := len(text); n > 3 && isCurrencyCode(text[n-3:]) {
+		if before := text[n-4]; before == ' ' || (before >= '0' && before <= '9') {
+			text = strings.TrimRightFunc(text[:n-3], unicode.IsSpace)
+		}
+	}
+
+	return sign + text
+}
+
+// isCurrencyCode reports whether code looks like an ISO 4217 currency code
+func isCurrencyCode(code string) bool {
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// OutputStyle formats bare numbers on output
+type OutputStyle struct {
+	Locale   Locale // separators written
+	Decimals int    // fixed decimal places, negative to write as many as the value needs
+	Pad      int    // right-align numbers in fields of at least this many characters
+}
+
+// format returns n, of the given type, written in the style. NaN and
+// infinities are only padded.
+func (s *OutputStyle) format(typ Type, n *number) string {
+	var text string
+	switch {
+	case n.nan:
+		text = "NaN"
+	case typ == Float64 && math.IsInf(n.f, 0), typ == BigFloat && n.bf.IsInf():
+		text = "-Inf"
+		if n.f > 0 || (n.bf != nil && n.bf.Sign() > 0) {
+			text = "+Inf"
+		}
+	default:
+		text = s.localize(s.digits(typ, n))
+	}
+
+	if pad := s.Pad - utf8.RuneCountInString(text); pad > 0 {
+		text = strings.Repeat(" ", pad) + text
+	}
+	return text
+}
+
+// digits writes the finite value n in plain decimal notation with the
+// configured number of decimal places
+func (s *OutputStyle) digits(typ Type, n *number) string {
+	switch typ {
+	case Float64:
+		return strconv.FormatFloat(n.f, 'f', max(s.Decimals, -1), 64)
+	case BigFloat:
+		return n.bf.Text('f', max(s.Decimals, -1))
+	}
+
+	text := strconv.FormatInt(n.i, 10)
+	if typ == BigInt {
+		text = n.b.String()
+	}
+	if s.Decimals > 0 {
+		text += "." + strings.Repeat("0", s.Decimals)
+	}
+	return text
+}
+
+// localize groups the integer digits of a plain decimal number and replaces
+// its decimal point
+func (s *OutputStyle) localize(text string) string {
+	sign := ""
+	if text != "" && text[0] == '-' {
+		sign, text = text[:1], text[1:]
+	}
+	integer, fraction, hasFraction := strings.Cut(text, ".")
+
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 && s.Locale.Grouping != 0 {
+			b.WriteRune(s.Locale.Grouping)
+		}
+		b.WriteRune(digit)
+	}
+	if hasFraction {
+		b.WriteRune(s.Locale.decimal())
+		b.WriteString(fraction)
+	}
+
+	return b.String()
+}
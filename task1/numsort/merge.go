@@ -0,0 +1,132 @@
+package numsort
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"io"
+)
+
+// mergeSource is one sorted input taking part in a k-way merge
+type mergeSource struct {
+	name   string
+	reader recordSource
+	format *recordFormat
+	head   record
+	index  int
+}
+
+// advance reads the next record of the source into head, checking that the
+// source really is sorted
+func (s *mergeSource) advance() error {
+	r, err := s.reader.Next()
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.name, err)
+	}
+
+	if err := checkOrder(s.format, s.head, r, s.name, s.reader.Position(), false); err != nil {
+		return err
+	}
+
+	s.head = r
+	return nil
+}
+
+// mergeHeap orders merge sources by their current head value. Ties are
+// broken by source index so equal values keep the order of their sources.
+type mergeHeap struct {
+	sources []*mergeSource
+	format  recordFormat
+}
+
+func (h *mergeHeap) Len() int { return len(h.sources) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	if c := h.format.compare(h.sources[i].head, h.sources[j].head); c != 0 {
+		return c < 0
+	}
+	return h.sources[i].index < h.sources[j].index
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.sources[i], h.sources[j] = h.sources[j], h.sources[i] }
+
+func (h *mergeHeap) Push(x any) { h.sources = append(h.sources, x.(*mergeSource)) }
+
+func (h *mergeHeap) Pop() any {
+	n := len(h.sources)
+	source := h.sources[n-1]
+	h.sources[n-1] = nil
+	h.sources = h.sources[:n-1]
+	return source
+}
+
+// mergeRecords k-way merges sorted sources, passing every record to emit in
+// sorted order. It fails at the first source that turns out not to be
+// sorted.
+func mergeRecords(sources []*mergeSource, rf recordFormat, emit func(record) error) error {
+	h := &mergeHeap{sources: make([]*mergeSource, 0, len(sources)), format: rf}
+
+	// Prime the heap with the first record of every source
+	for i, source := range sources {
+		num, err := source.reader.Next()
+		if err == io.EOF {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", source.name, err)
+		}
+		source.head = num
+		source.index = i
+		h.sources = append(h.sources, source)
+	}
+	heap.Init(h)
+
+	for h.Len() > 0 {
+		source := h.sources[0]
+		if err := emit(source.head); err != nil {
+			return err
+		}
+
+		err := source.advance()
+		if err == io.EOF {
+			heap.Pop(h)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		heap.Fix(h, 0)
+	}
+
+	return nil
+}
+
+// mergeInputs k-way merges sorted inputs into w. It returns the number of
+// records read and lines written.
+func mergeInputs(w io.Writer, inputs []Input, opts sortOptions) (int, int, error) {
+	sources := make([]*mergeSource, 0, len(inputs))
+	for _, input := range inputs {
+		reader := opts.newSource(bufio.NewReaderSize(input.Reader, runBufferSize), input.Name)
+		sources = append(sources, &mergeSource{name: input.Name, reader: reader, format: &opts.format})
+	}
+
+	writer := newRecordWriter(w, &opts)
+	count := 0
+	err := mergeRecords(sources, opts.format, func(r record) error {
+		count++
+		return writer.Write(r)
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write merged output: %w", err)
+	}
+
+	return count, writer.written, nil
+}
@@ -0,0 +1,199 @@
+package numsort
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// bigFloatPrec is the mantissa precision in bits used for bigfloat values
+const bigFloatPrec = 256
+
+// Type selects how numeric text is parsed and ordered
+type Type int
+
+const (
+	Int      Type = iota // platform int, decimal or 0x hex
+	Int64                // 64-bit integer, decimal or 0x hex
+	Float64              // 64-bit float, including Inf and NaN
+	BigInt               // arbitrary precision integer
+	BigFloat             // 256-bit mantissa float, including Inf and NaN
+)
+
+var typeNames = map[string]Type{
+	"int":      Int,
+	"int64":    Int64,
+	"float64":  Float64,
+	"bigint":   BigInt,
+	"bigfloat": BigFloat,
+}
+
+// ParseType converts a type name such as "int64" or "bigfloat" into a Type
+func ParseType(name string) (Type, error) {
+	typ, ok := typeNames[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown number type %q (want int, int64, float64, bigint or bigfloat)", name)
+	}
+	return typ, nil
+}
+
+// number is a parsed value together with the text it was parsed from. Only
+// the fields belonging to the number type in use are set.
+type number struct {
+	text string
+	i    int64
+	f    float64
+	b    *big.Int
+	bf   *big.Float
+	nan  bool
+}
+
+// numberFormat parses, orders and prints numbers of one type
+type numberFormat struct {
+	typ       Type
+	nanFirst  bool         // sort NaN before every other value instead of after
+	normalize bool         // print the canonical form instead of the original text
+	locale    Locale       // separators of the input
+	currency  bool         // ignore currency symbols and codes around the input
+	style     *OutputStyle // print numbers in this style instead of their original text
+}
+
+// parse converts trimmed text into a number. Integer types accept decimal
+// and 0x-prefixed hex literals; float types additionally accept decimal
+// fractions, exponents, Inf and NaN. Text is first read in the input locale.
+func (nf *numberFormat) parse(text string) (number, error) {
+	n := number{text: text}
+
+	if nf.currency {
+		text = stripCurrency(text)
+	}
+	text, err := nf.locale.delocalize(text)
+	if err != nil {
+		return n, err
+	}
+
+	switch nf.typ {
+	case Int, Int64:
+		bitSize := 64
+		if nf.typ == Int {
+			bitSize = strconv.IntSize
+		}
+		base := 10
+		digits, isHex := cutHexPrefix(text)
+		if isHex {
+			base = 16
+		}
+		i, err := strconv.ParseInt(digits, base, bitSize)
+		if err != nil {
+			return n, err
+		}
+		n.i = i
+
+	case Float64:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			// Plain hex integers are not valid Go float syntax
+			digits, isHex := cutHexPrefix(text)
+			b, ok := new(big.Int).SetString(digits, 16)
+			if !isHex || !ok {
+				return n, err
+			}
+			f, _ = new(big.Float).SetInt(b).Float64()
+		}
+		n.f = f
+		n.nan = math.IsNaN(f)
+
+	case BigInt:
+		base := 10
+		digits, isHex := cutHexPrefix(text)
+		if isHex {
+			base = 16
+		}
+		b, ok := new(big.Int).SetString(digits, base)
+		if !ok {
+			return n, fmt.Errorf("invalid integer syntax")
+		}
+		n.b = b
+
+	case BigFloat:
+		if strings.EqualFold(strings.TrimLeft(text, "+-"), "nan") {
+			n.nan = true
+			return n, nil
+		}
+		bf, _, err := new(big.Float).SetPrec(bigFloatPrec).Parse(text, 0)
+		if err != nil {
+			return n, err
+		}
+		n.bf = bf
+	}
+
+	return n, nil
+}
+
+// compare orders a and b, returning -1, 0 or +1. NaN values are equal to
+// each other and placed before or after all other values according to
+// nanFirst; infinities sort at the ends of the real line.
+func (nf *numberFormat) compare(a, b *number) int {
+	if a.nan || b.nan {
+		switch {
+		case a.nan && b.nan:
+			return 0
+		case a.nan == nf.nanFirst:
+			return -1
+		default:
+			return 1
+		}
+	}
+
+	switch nf.typ {
+	case Float64:
+		return cmp.Compare(a.f, b.f)
+	case BigInt:
+		return a.b.Cmp(b.b)
+	case BigFloat:
+		return a.bf.Cmp(b.bf)
+	default:
+		return cmp.Compare(a.i, b.i)
+	}
+}
+
+// format returns the text written to the output for n
+func (nf *numberFormat) format(n number) string {
+	if nf.style != nil {
+		return nf.style.format(nf.typ, &n)
+	}
+	if !nf.normalize {
+		return n.text
+	}
+	if n.nan {
+		return "NaN"
+	}
+
+	switch nf.typ {
+	case Float64:
+		return strconv.FormatFloat(n.f, 'g', -1, 64)
+	case BigInt:
+		return n.b.String()
+	case BigFloat:
+		return n.bf.Text('g', -1)
+	default:
+		return strconv.FormatInt(n.i, 10)
+	}
+}
+
+// cutHexPrefix strips a 0x or 0X prefix from text, keeping any sign, and
+// reports whether the prefix was present. A sign must come before the
+// prefix: "0x-5" is not hex, and is left for the parser to reject.
+func cutHexPrefix(text string) (string, bool) {
+	sign, rest := "", text
+	if rest != "" && (rest[0] == '+' || rest[0] == '-') {
+		sign, rest = rest[:1], rest[1:]
+	}
+	if len(rest) > 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X') && rest[2] != '+' && rest[2] != '-' {
+		return sign + rest[2:], true
+	}
+	return text, false
+}
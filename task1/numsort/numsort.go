@@ -0,0 +1,406 @@
+// Package numsort sorts, merges and checks line-based numeric data. Lines
+// hold either a single number or delimited fields with numeric and text sort
+// keys. Inputs larger than a memory budget are sorted externally through
+// temporary run files.
+package numsort
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// Order is the direction of a sort
+type Order int
+
+const (
+	Ascending Order = iota
+	Descending
+)
+
+// StatsOptions configures the statistics computed by Sort
+type StatsOptions struct {
+	Percentiles []float64 // percentiles between 0 and 100 to report
+	Buckets     int       // histogram buckets, 0 for no histogram
+}
+
+// Options configures how lines are parsed, ordered and written. The zero
+// value sorts one int per line in ascending order, in memory, and fails at
+// the first line that does not parse.
+type Options struct {
+	Type      Type
+	Order     Order
+	NaNFirst  bool  // sort NaN before every other value instead of after
+	Normalize bool  // write bare numbers in canonical form instead of their original text
+	Keys      []Key // sort keys; nil sorts whole lines as numbers
+
+	// InputLocale is the locale numbers are read in. StripCurrency ignores
+	// currency symbols and trailing ISO codes, as in "1.234,50 EUR".
+	InputLocale   Locale
+	StripCurrency bool
+
+	// Output writes bare numbers in a locale style instead of their
+	// original text; nil keeps the text. Delimited records are always
+	// written unchanged.
+	Output *OutputStyle
+
+	Delimiter string // field delimiter for Keys: "" splits on runs of whitespace, "csv" honours CSV quoting
+	Dedup     Dedup  // how runs of equal records are written
+
+	// Lenient skips lines that fail to parse, logging them to Rejects, and
+	// fails once more than MaxRejectRatio (0 to 1) of all lines are rejected
+	Lenient        bool
+	Rejects        io.Writer
+	MaxRejectRatio float64
+
+	// Limit keeps only the first Limit records of the sort order, e.g. the
+	// smallest values, or the largest ones with Order set to Descending.
+	// They are selected in one pass with a bounded heap instead of a full
+	// sort. 0 keeps every record.
+	Limit int
+
+	Workers   int    // goroutines used to sort in memory, 0 for one per CPU
+	MaxMemory int64  // bytes of parsed records held before spilling sorted runs to disk, 0 for no limit
+	TempDir   string // directory for run files, "" for the system temp directory
+
+	// Binary formats hold packed Bits-wide integers in ByteOrder instead of
+	// lines. They need an Int or Int64 Type and no Keys; reading text and
+	// writing binary, or the reverse, converts between the two.
+	InputFormat  Format
+	OutputFormat Format
+	Bits         int              // 32 or 64, 0 for 64
+	ByteOrder    binary.ByteOrder // nil for little endian
+
+	Name     string        // input name used in errors and reject entries
+	Stats    *StatsOptions // compute statistics of the sorted values; needs an in-memory sort
+	Progress *Progress     // updated as the run goes on, may be nil
+}
+
+// Input is a named sorted input of Merge
+type Input struct {
+	Name   string
+	Reader io.Reader
+}
+
+// Result describes a completed run
+type Result struct {
+	Records  int    // records read
+	Written  int    // lines written
+	Rejected int    // lines skipped in lenient mode
+	Stats    *Stats // statistics, when requested
+}
+
+// sortOptions is the validated internal form of Options
+type sortOptions struct {
+	format   recordFormat
+	workers  int        // goroutines used to sort in memory
+	maxBytes int64      // memory budget of an external sort
+	tempDir  string     // directory for external sort runs
+	rejects  *rejectLog // log of unparsable lines, nil aborts on the first one
+	dedup    Dedup      // how runs of equal records are written
+	name     string     // input name used in errors and reject entries
+	input    Format     // format of the inputs
+	output   Format     // format of the output
+	layout   binaryLayout
+	ctx      context.Context
+	progress *Progress
+}
+
+// newSortOptions validates opts and converts them into sortOptions for a
+// run that stops once ctx is cancelled
+func newSortOptions(ctx context.Context, opts Options) (sortOptions, error) {
+	if opts.Type < Int || opts.Type > BigFloat {
+		return sortOptions{}, fmt.Errorf("unknown number type %d", opts.Type)
+	}
+	if opts.Order != Ascending && opts.Order != Descending {
+		return sortOptions{}, fmt.Errorf("unknown order %d", opts.Order)
+	}
+	if opts.Dedup < KeepAll || opts.Dedup > Duplicates {
+		return sortOptions{}, fmt.Errorf("unknown dedup mode %d", opts.Dedup)
+	}
+	for _, key := range opts.Keys {
+		if key.Field < 0 {
+			return sortOptions{}, fmt.Errorf("invalid key field %d: must not be negative", key.Field)
+		}
+	}
+	if opts.Workers < 0 {
+		return sortOptions{}, fmt.Errorf("invalid workers %d: must not be negative", opts.Workers)
+	}
+	if opts.Limit < 0 {
+		return sortOptions{}, fmt.Errorf("invalid limit %d: must not be negative", opts.Limit)
+	}
+	if opts.Limit > 0 && opts.Dedup != KeepAll {
+		return sortOptions{}, errors.New("a limit cannot be combined with deduplication")
+	}
+	if opts.MaxMemory < 0 {
+		return sortOptions{}, fmt.Errorf("invalid memory limit %d: must not be negative", opts.MaxMemory)
+	}
+	if opts.InputFormat == BinaryFormat || opts.OutputFormat == BinaryFormat {
+		if opts.Type != Int && opts.Type != Int64 {
+			return sortOptions{}, errors.New("binary formats need an int or int64 type")
+		}
+		if len(opts.Keys) > 0 {
+			return sortOptions{}, errors.New("binary formats cannot be combined with sort keys")
+		}
+		if opts.Bits != 0 && opts.Bits != 32 && opts.Bits != 64 {
+			return sortOptions{}, fmt.Errorf("invalid bits %d: must be 32 or 64", opts.Bits)
+		}
+	}
+	if err := opts.InputLocale.validate(); err != nil {
+		return sortOptions{}, fmt.Errorf("invalid input locale: %w", err)
+	}
+	if opts.Output != nil {
+		if err := opts.Output.Locale.validate(); err != nil {
+			return sortOptions{}, fmt.Errorf("invalid output locale: %w", err)
+		}
+	}
+	if opts.OutputFormat == BinaryFormat && opts.Dedup == Count {
+		return sortOptions{}, errBinaryCount
+	}
+
+	so := sortOptions{
+		format: recordFormat{
+			numbers: numberFormat{
+				typ:       opts.Type,
+				nanFirst:  opts.NaNFirst,
+				normalize: opts.Normalize,
+				locale:    opts.InputLocale,
+				currency:  opts.StripCurrency,
+				style:     opts.Output,
+			},
+			keys:      opts.Keys,
+			delimiter: opts.Delimiter,
+			reverse:   opts.Order == Descending,
+		},
+		workers:  opts.Workers,
+		maxBytes: opts.MaxMemory,
+		tempDir:  opts.TempDir,
+		dedup:    opts.Dedup,
+		name:     opts.Name,
+		input:    opts.InputFormat,
+		output:   opts.OutputFormat,
+		layout:   binaryLayout{size: 8, order: opts.ByteOrder},
+		ctx:      ctx,
+		progress: opts.Progress,
+	}
+	if len(so.format.keys) == 0 {
+		so.format.keys = defaultKeys
+	}
+	if so.workers == 0 {
+		so.workers = runtime.NumCPU()
+	}
+	if so.name == "" {
+		so.name = "input"
+	}
+	if opts.Bits == 32 {
+		so.layout.size = 4
+	}
+	if so.layout.order == nil {
+		so.layout.order = binary.LittleEndian
+	}
+
+	if opts.Lenient {
+		if opts.MaxRejectRatio < 0 || opts.MaxRejectRatio > 1 {
+			return sortOptions{}, fmt.Errorf("invalid reject ratio %g: must be between 0 and 1", opts.MaxRejectRatio)
+		}
+		so.rejects = newRejectLog(opts.Rejects, opts.MaxRejectRatio)
+	}
+
+	return so, nil
+}
+
+// errStatsNeedMemory is returned when statistics are requested from a run
+// that does not hold all records in memory
+var errStatsNeedMemory = errors.New("statistics need an in-memory sort")
+
+// Sort reads lines from r and writes them to w in sorted order. Equal
+// records keep their input order. With a Limit only the first records are
+// kept and MaxMemory is ignored. With MaxMemory set, sorted runs are spilled
+// to temporary files and merged; the files are removed whether or not the
+// sort succeeds. w may be nil to only compute statistics.
+func Sort(r io.Reader, w io.Writer, opts Options) (Result, error) {
+	return SortContext(context.Background(), r, w, opts)
+}
+
+// SortContext is like Sort but stops with the context's error once ctx is
+// cancelled. Anything already written to w is then incomplete.
+func SortContext(ctx context.Context, r io.Reader, w io.Writer, opts Options) (Result, error) {
+	so, err := newSortOptions(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	so.progress.start(PhaseRead, 0)
+
+	if opts.Limit > 0 {
+		if opts.Stats != nil {
+			return Result{}, errors.New("statistics cannot be combined with a limit")
+		}
+		if w == nil {
+			w = io.Discard
+		}
+		return selectTo(r, w, so, opts.Limit)
+	}
+
+	if so.maxBytes > 0 {
+		if opts.Stats != nil {
+			return Result{}, errStatsNeedMemory
+		}
+		if w == nil {
+			w = io.Discard
+		}
+		count, written, err := externalSort(r, w, so)
+		return Result{Records: count, Written: written, Rejected: so.rejects.rejected()}, err
+	}
+
+	records, err := readRecords(r, so)
+	if err == nil {
+		err = so.rejects.check(len(records))
+	}
+	if err != nil {
+		return Result{Rejected: so.rejects.rejected()}, err
+	}
+
+	// Sort records by their keys, keeping equal records in input order
+	so.progress.start(PhaseSort, len(records))
+	records, err = sortRecords(ctx, records, so.format, so.workers)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{Records: len(records), Rejected: so.rejects.rejected()}
+
+	if opts.Stats != nil {
+		values, err := keyValues(records, &so.format)
+		if err != nil {
+			return result, err
+		}
+		stats := computeStats(values, opts.Stats.Percentiles, opts.Stats.Buckets)
+		result.Stats = &stats
+	}
+
+	if w != nil {
+		so.progress.start(PhaseWrite, len(records))
+		result.Written, err = writeRecords(w, records, so)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Merge k-way merges already sorted inputs into w. Equal records are taken
+// from earlier inputs first. It fails at the first input that turns out not
+// to be sorted.
+func Merge(inputs []Input, w io.Writer, opts Options) (Result, error) {
+	return MergeContext(context.Background(), inputs, w, opts)
+}
+
+// MergeContext is like Merge but stops with the context's error once ctx is
+// cancelled
+func MergeContext(ctx context.Context, inputs []Input, w io.Writer, opts Options) (Result, error) {
+	so, err := newSortOptions(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	if opts.Stats != nil {
+		return Result{}, errStatsNeedMemory
+	}
+	if opts.Limit > 0 {
+		return Result{}, errors.New("a limit cannot be combined with merging")
+	}
+
+	so.progress.start(PhaseMerge, 0)
+	count, written, err := mergeInputs(w, inputs, so)
+	if err == nil {
+		err = so.rejects.check(count)
+	}
+
+	return Result{Records: count, Written: written, Rejected: so.rejects.rejected()}, err
+}
+
+// Check streams r and fails with an *OrderError at the first record that is
+// out of order. With Dedup set to Unique, records equal to their predecessor
+// fail as well. Nothing is written.
+func Check(r io.Reader, opts Options) (Result, error) {
+	return CheckContext(context.Background(), r, opts)
+}
+
+// CheckContext is like Check but stops with the context's error once ctx is
+// cancelled
+func CheckContext(ctx context.Context, r io.Reader, opts Options) (Result, error) {
+	so, err := newSortOptions(ctx, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	so.progress.start(PhaseRead, 0)
+
+	count, err := checkSorted(r, so, opts.Dedup == Unique)
+	if err == nil {
+		err = so.rejects.check(count)
+	}
+
+	return Result{Records: count, Rejected: so.rejects.rejected()}, err
+}
+
+// selectTo writes the first limit records of r's sort order to w
+func selectTo(r io.Reader, w io.Writer, opts sortOptions, limit int) (Result, error) {
+	records, count, err := selectRecords(r, opts, limit)
+	if err == nil {
+		err = opts.rejects.check(count)
+	}
+	if err != nil {
+		return Result{Rejected: opts.rejects.rejected()}, err
+	}
+
+	opts.progress.start(PhaseWrite, len(records))
+	result := Result{Records: count, Rejected: opts.rejects.rejected()}
+	result.Written, err = writeRecords(w, records, opts)
+	return result, err
+}
+
+// readRecords reads every record of r
+func readRecords(r io.Reader, opts sortOptions) ([]record, error) {
+	source := opts.newSource(r, opts.name)
+
+	var records []record
+	for {
+		rec, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, rec)
+	}
+
+	return records, nil
+}
+
+// writeRecords writes sorted records to w, one per line, and returns the
+// number of lines written
+func writeRecords(w io.Writer, records []record, opts sortOptions) (int, error) {
+	writer := newRecordWriter(w, &opts)
+	for i, r := range records {
+		if i%cancelCheckInterval == 0 {
+			if err := opts.ctx.Err(); err != nil {
+				return 0, err
+			}
+		}
+		if err := writer.Write(r); err != nil {
+			return 0, err
+		}
+		opts.progress.add(1)
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write output: %w", err)
+	}
+
+	return writer.written, nil
+}
@@ -0,0 +1,725 @@
+package numsort
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// sortTest is a case of the Sort table tests
+type sortTest struct {
+	name     string
+	input    string
+	opts     Options
+	want     string
+	wantErr  string
+	rejected int
+}
+
+// runSortTests sorts the input of each test and checks the output, or the
+// error, and the lines written and rejected
+func runSortTests(t *testing.T, tests []sortTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			result, err := Sort(strings.NewReader(tt.input), &out, tt.opts)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Sort() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Sort() error = %v", err)
+				}
+				if got := out.String(); got != tt.want {
+					t.Errorf("Sort() wrote %q, want %q", got, tt.want)
+				}
+				// Binary output has no lines to count
+				if lines := strings.Count(tt.want, "\n"); tt.opts.OutputFormat != BinaryFormat && result.Written != lines {
+					t.Errorf("Sort() Written = %d, want %d", result.Written, lines)
+				}
+			}
+
+			if result.Rejected != tt.rejected {
+				t.Errorf("Sort() Rejected = %d, want %d", result.Rejected, tt.rejected)
+			}
+		})
+	}
+}
+
+func TestSort(t *testing.T) {
+	tests := []sortTest{
+		{
+			name:  "empty input",
+			input: "",
+			want:  "",
+		},
+		{
+			name:  "empty lines",
+			input: "\n3\n\n\n1\n\n2\n\n",
+			want:  "1\n2\n3\n",
+		},
+		{
+			name:  "whitespace",
+			input: "  3\n\t1\t\n2  \n   \n \t \n",
+			want:  "1\n2\n3\n",
+		},
+		{
+			name:  "negative numbers",
+			input: "-3\n10\n-10\n0\n-0\n7\n",
+			want:  "-10\n-3\n0\n-0\n7\n10\n",
+		},
+		{
+			name:  "int64 limits",
+			input: "9223372036854775807\n-9223372036854775808\n0\n",
+			opts:  Options{Type: Int64},
+			want:  "-9223372036854775808\n0\n9223372036854775807\n",
+		},
+		{
+			name:    "overflow",
+			input:   "1\n9223372036854775808\n",
+			opts:    Options{Type: Int64},
+			wantErr: "invalid number '9223372036854775808' on line 2",
+		},
+		{
+			name:    "negative overflow",
+			input:   "-9223372036854775809\n",
+			opts:    Options{Type: Int64},
+			wantErr: "value out of range",
+		},
+		{
+			name:  "overflow as bigint",
+			input: "9223372036854775808\n-9223372036854775809\n1\n",
+			opts:  Options{Type: BigInt},
+			want:  "-9223372036854775809\n1\n9223372036854775808\n",
+		},
+		{
+			name:    "invalid line",
+			input:   "1\nabc\n2\n",
+			wantErr: "invalid number 'abc' on line 2",
+		},
+		{
+			name:    "fraction as int",
+			input:   "1.5\n",
+			wantErr: "invalid number '1.5' on line 1",
+		},
+		{
+			name:     "invalid lines lenient",
+			input:    "1\nabc\n3\n12x\n2\n",
+			opts:     Options{Lenient: true, MaxRejectRatio: 0.5},
+			want:     "1\n2\n3\n",
+			rejected: 2,
+		},
+		{
+			name:     "invalid lines over budget",
+			input:    "1\nabc\n3\n",
+			opts:     Options{Lenient: true, MaxRejectRatio: 0.1},
+			wantErr:  "too many rejected lines",
+			rejected: 1,
+		},
+		{
+			name:  "hex",
+			input: "0x10\n-0x1\n15\n",
+			want:  "-0x1\n15\n0x10\n",
+		},
+		{
+			name:    "sign after hex prefix",
+			input:   "1\n0x-5\n",
+			wantErr: "invalid number '0x-5' on line 2",
+		},
+		{
+			name:    "plus sign after hex prefix as bigint",
+			input:   "0x+2\n1\n",
+			opts:    Options{Type: BigInt},
+			wantErr: "invalid number '0x+2' on line 1",
+		},
+		{
+			name:    "sign after hex prefix as float",
+			input:   "0x-5\n",
+			opts:    Options{Type: Float64},
+			wantErr: "invalid number '0x-5' on line 1",
+		},
+		{
+			name:     "sign after hex prefix lenient",
+			input:    "0x-5\n0x+2\n-0x2\n3\n",
+			opts:     Options{Lenient: true, MaxRejectRatio: 0.5, Normalize: true},
+			want:     "-2\n3\n",
+			rejected: 2,
+		},
+		{
+			name:  "descending",
+			input: "2\n-1\n3\n",
+			opts:  Options{Order: Descending},
+			want:  "3\n2\n-1\n",
+		},
+		{
+			name:  "floats with NaN and Inf",
+			input: "NaN\n1.5\n-Inf\n-2e3\n+Inf\n",
+			opts:  Options{Type: Float64},
+			want:  "-Inf\n-2e3\n1.5\n+Inf\nNaN\n",
+		},
+		{
+			name:  "NaN first",
+			input: "1\nNaN\n-1\n",
+			opts:  Options{Type: Float64, NaNFirst: true},
+			want:  "NaN\n-1\n1\n",
+		},
+		{
+			name:  "normalize",
+			input: "1e2\n0x10\n-0.50\n",
+			opts:  Options{Type: Float64, Normalize: true},
+			want:  "-0.5\n16\n100\n",
+		},
+		{
+			name:  "bigfloat",
+			input: "1e400\n-1e400\n0.1\n",
+			opts:  Options{Type: BigFloat},
+			want:  "-1e400\n0.1\n1e400\n",
+		},
+		{
+			name:  "keys are stable",
+			input: "b 2\na 1\nc 2\nd 1\n",
+			opts:  Options{Keys: []Key{{Field: 2, Numeric: true}}},
+			want:  "a 1\nd 1\nb 2\nc 2\n",
+		},
+		{
+			name:  "reverse numeric key then text key",
+			input: "b,2\na,1\nc,2\na,2\n",
+			opts:  Options{Keys: []Key{{Field: 2, Numeric: true, Reverse: true}, {Field: 1}}, Delimiter: ","},
+			want:  "a,2\nb,2\nc,2\na,1\n",
+		},
+		{
+			name:  "csv quoting",
+			input: "\"x,y\",3\nz,-1\n",
+			opts:  Options{Keys: []Key{{Field: 2, Numeric: true}}, Delimiter: "csv"},
+			want:  "z,-1\n\"x,y\",3\n",
+		},
+		{
+			name:    "missing key field",
+			input:   "a 1\nb\n",
+			opts:    Options{Keys: []Key{{Field: 2, Numeric: true}}},
+			wantErr: "in field 2 on line 2: field is missing",
+		},
+		{
+			name:  "unique",
+			input: "2\n1\n2\n3\n1\n",
+			opts:  Options{Dedup: Unique},
+			want:  "1\n2\n3\n",
+		},
+		{
+			name:  "count",
+			input: "2\n1\n2\n3\n2\n",
+			opts:  Options{Dedup: Count},
+			want:  "1 1\n2 3\n3 1\n",
+		},
+		{
+			name:  "duplicates",
+			input: "2\n1\n2\n3\n1\n",
+			opts:  Options{Dedup: Duplicates},
+			want:  "1\n2\n",
+		},
+		{
+			name:  "external",
+			input: "5\n-3\n\n 4\n1\n-3\n2\n0\n",
+			opts:  Options{MaxMemory: 1},
+			want:  "-3\n-3\n0\n1\n2\n4\n5\n",
+		},
+		{
+			name:  "external unique descending",
+			input: "5\n-3\n4\n1\n-3\n2\n5\n",
+			opts:  Options{MaxMemory: 1, Order: Descending, Dedup: Unique},
+			want:  "5\n4\n2\n1\n-3\n",
+		},
+		{
+			name:    "external invalid line",
+			input:   "5\n-3\nx\n",
+			opts:    Options{MaxMemory: 1},
+			wantErr: "invalid number 'x' on line 3",
+		},
+		{
+			name:  "limit smallest",
+			input: "5\n-3\n\n4\n1\n-7\n2\n",
+			opts:  Options{Limit: 3},
+			want:  "-7\n-3\n1\n",
+		},
+		{
+			name:  "limit largest",
+			input: "5\n-3\n4\n1\n-7\n2\n",
+			opts:  Options{Limit: 2, Order: Descending},
+			want:  "5\n4\n",
+		},
+		{
+			name:  "limit keeps the first of equal records",
+			input: "a 2\nb 1\nc 1\nd 1\ne 0\n",
+			opts:  Options{Limit: 3, Keys: []Key{{Field: 2, Numeric: true}}},
+			want:  "e 0\nb 1\nc 1\n",
+		},
+		{
+			name:  "limit beyond input",
+			input: "3\n1\n2\n",
+			opts:  Options{Limit: 10},
+			want:  "1\n2\n3\n",
+		},
+		{
+			name:     "limit lenient",
+			input:    "3\nx\n1\n2\n",
+			opts:     Options{Limit: 1, Lenient: true, MaxRejectRatio: 0.5},
+			want:     "1\n",
+			rejected: 1,
+		},
+		{
+			name:    "limit with dedup",
+			input:   "1\n",
+			opts:    Options{Limit: 1, Dedup: Unique},
+			wantErr: "cannot be combined with deduplication",
+		},
+		{
+			name:    "invalid options",
+			input:   "1\n",
+			opts:    Options{Workers: -1},
+			wantErr: "invalid workers",
+		},
+	}
+
+	runSortTests(t, tests)
+}
+
+func TestSortRejects(t *testing.T) {
+	var rejects strings.Builder
+	opts := Options{Lenient: true, Rejects: &rejects, MaxRejectRatio: 1, Name: "data.txt"}
+
+	if _, err := Sort(strings.NewReader("1\n\n oops \n2\n"), nil, opts); err != nil {
+		t.Fatalf("Sort() error = %v", err)
+	}
+
+	want := "data.txt:3\tinvalid number 'oops' on line 3: strconv.ParseInt: parsing \"oops\": invalid syntax\t oops \n"
+	if got := rejects.String(); got != want {
+		t.Errorf("rejects = %q, want %q", got, want)
+	}
+}
+
+func TestSortStats(t *testing.T) {
+	opts := Options{Stats: &StatsOptions{Percentiles: []float64{50}, Buckets: 2}}
+
+	result, err := Sort(strings.NewReader("4\n1\n3\n2\n"), nil, opts)
+	if err != nil {
+		t.Fatalf("Sort() error = %v", err)
+	}
+
+	stats := result.Stats
+	if stats == nil {
+		t.Fatal("Sort() returned no stats")
+	}
+	if stats.Count != 4 || stats.Min != 1 || stats.Max != 4 || stats.Mean != 2.5 || stats.Median != 2.5 {
+		t.Errorf("stats = %+v", *stats)
+	}
+	if len(stats.Histogram) != 2 || stats.Histogram[0].Count != 2 || stats.Histogram[1].Count != 2 {
+		t.Errorf("histogram = %+v", stats.Histogram)
+	}
+
+	opts.MaxMemory = 1
+	if _, err := Sort(strings.NewReader("1\n"), nil, opts); err == nil {
+		t.Error("Sort() with stats and a memory limit succeeded")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		inputs  []string
+		opts    Options
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "interleaved",
+			inputs: []string{"1\n4\n7\n", "\n2\n 5 \n", "3\n6\n"},
+			want:   "1\n2\n3\n4\n5\n6\n7\n",
+		},
+		{
+			name:   "empty inputs",
+			inputs: []string{"", "1\n", ""},
+			want:   "1\n",
+		},
+		{
+			name:   "ties keep input order",
+			inputs: []string{"a 1\nb 2\n", "c 1\nd 2\n"},
+			opts:   Options{Keys: []Key{{Field: 2, Numeric: true}}},
+			want:   "a 1\nc 1\nb 2\nd 2\n",
+		},
+		{
+			name:   "descending unique",
+			inputs: []string{"3\n2\n-1\n", "3\n-1\n-5\n"},
+			opts:   Options{Order: Descending, Dedup: Unique},
+			want:   "3\n2\n-1\n-5\n",
+		},
+		{
+			name:    "unsorted input",
+			inputs:  []string{"1\n2\n", "3\n-1\n"},
+			wantErr: "input1 is not sorted: line 2 has -1 after 3",
+		},
+		{
+			name:    "invalid line",
+			inputs:  []string{"1\n", "2\nx\n"},
+			wantErr: "input1: invalid number 'x' on line 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputs := make([]Input, len(tt.inputs))
+			for i, text := range tt.inputs {
+				inputs[i] = Input{Name: "input" + string(rune('0'+i)), Reader: strings.NewReader(text)}
+			}
+
+			var out strings.Builder
+			_, err := Merge(inputs, &out, tt.opts)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Merge() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Merge() error = %v", err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("Merge() wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		opts      Options
+		records   int
+		wantLine  int
+		duplicate bool
+		wantErr   string
+	}{
+		{
+			name:    "sorted",
+			input:   "-2\n\n-1\n 1 \n1\n",
+			records: 4,
+		},
+		{
+			name:     "unsorted",
+			input:    "1\n3\n2\n",
+			records:  2,
+			wantLine: 3,
+		},
+		{
+			name:      "not unique",
+			input:     "1\n\n1\n",
+			opts:      Options{Dedup: Unique},
+			records:   1,
+			wantLine:  3,
+			duplicate: true,
+		},
+		{
+			name:    "descending",
+			input:   "3\n2\n2\n-1\n",
+			opts:    Options{Order: Descending},
+			records: 4,
+		},
+		{
+			name:    "invalid line",
+			input:   "1\n2\n+\n",
+			records: 2,
+			wantErr: "invalid number '+' on line 3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Check(strings.NewReader(tt.input), tt.opts)
+
+			var orderErr *OrderError
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Check() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			case tt.wantLine != 0:
+				if !errors.As(err, &orderErr) {
+					t.Fatalf("Check() error = %v, want an *OrderError", err)
+				}
+				if orderErr.Line != tt.wantLine || orderErr.Duplicate != tt.duplicate {
+					t.Errorf("Check() error at line %d (duplicate %v), want line %d (duplicate %v)",
+						orderErr.Line, orderErr.Duplicate, tt.wantLine, tt.duplicate)
+				}
+			case err != nil:
+				t.Fatalf("Check() error = %v", err)
+			}
+
+			if result.Records != tt.records {
+				t.Errorf("Check() Records = %d, want %d", result.Records, tt.records)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Key
+		wantErr bool
+	}{
+		{value: "1", want: Key{Field: 1}},
+		{value: "3n", want: Key{Field: 3, Numeric: true}},
+		{value: "2nr", want: Key{Field: 2, Numeric: true, Reverse: true}},
+		{value: "2rn", want: Key{Field: 2, Numeric: true, Reverse: true}},
+		{value: "0", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "n", wantErr: true},
+		{value: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseKey(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseKey(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseKey(%q) = %+v, want %+v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortBinary(t *testing.T) {
+	tests := []sortTest{
+		{
+			name:  "text to little endian int32",
+			input: "2\n-1\n\n 256 \n",
+			opts:  Options{OutputFormat: BinaryFormat, Bits: 32},
+			want:  "\xff\xff\xff\xff\x02\x00\x00\x00\x00\x01\x00\x00",
+		},
+		{
+			name:  "big endian int64 to text",
+			input: "\x00\x00\x00\x00\x00\x00\x00\x05\xff\xff\xff\xff\xff\xff\xff\xfe",
+			opts:  Options{InputFormat: BinaryFormat, ByteOrder: binary.BigEndian},
+			want:  "-2\n5\n",
+		},
+		{
+			name:  "binary to binary descending unique",
+			input: "\x01\x00\x00\x00\x03\x00\x00\x00\x01\x00\x00\x00",
+			opts:  Options{InputFormat: BinaryFormat, OutputFormat: BinaryFormat, Bits: 32, Order: Descending, Dedup: Unique},
+			want:  "\x03\x00\x00\x00\x01\x00\x00\x00",
+		},
+		{
+			name:  "external binary",
+			input: "\x03\x00\x00\x00\xfe\xff\xff\xff\x01\x00\x00\x00",
+			opts:  Options{InputFormat: BinaryFormat, OutputFormat: BinaryFormat, Bits: 32, MaxMemory: 1},
+			want:  "\xfe\xff\xff\xff\x01\x00\x00\x00\x03\x00\x00\x00",
+		},
+		{
+			name:    "truncated input",
+			input:   "\x01\x00\x00\x00\x02\x00",
+			opts:    Options{InputFormat: BinaryFormat, Bits: 32},
+			wantErr: "truncated value 2",
+		},
+		{
+			name:    "overflow of 32-bit output",
+			input:   "2147483648\n",
+			opts:    Options{OutputFormat: BinaryFormat, Bits: 32},
+			wantErr: "out of range for 32-bit output",
+		},
+		{
+			name:    "float type",
+			input:   "1\n",
+			opts:    Options{OutputFormat: BinaryFormat, Type: Float64},
+			wantErr: "need an int or int64 type",
+		},
+		{
+			name:    "counts",
+			input:   "1\n",
+			opts:    Options{OutputFormat: BinaryFormat, Dedup: Count},
+			wantErr: "value counts cannot be written in binary",
+		},
+	}
+
+	runSortTests(t, tests)
+}
+
+func TestSortContextCanceled(t *testing.T) {
+	input := strings.Repeat("3\n1\n2\n", 2000)
+
+	for _, maxMemory := range []int64{0, 1} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var out strings.Builder
+		_, err := SortContext(ctx, strings.NewReader(input), &out, Options{MaxMemory: maxMemory})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("SortContext() with MaxMemory %d error = %v, want context.Canceled", maxMemory, err)
+		}
+	}
+}
+
+func TestSortRecordsCanceled(t *testing.T) {
+	input := strings.Repeat("3\n1\n2\n", 20000)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, typ := range []Type{Int, Float64} {
+		for _, workers := range []int{1, 4} {
+			so, err := newSortOptions(context.Background(), Options{Type: typ, Workers: workers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			records, err := readRecords(strings.NewReader(input), so)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = sortRecords(ctx, records, so.format, workers)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("sortRecords() with type %v and %d workers error = %v, want context.Canceled", typ, workers, err)
+			}
+		}
+	}
+}
+
+func TestSortProgress(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		phase Phase
+	}{
+		{name: "in memory", opts: Options{}, phase: PhaseWrite},
+		{name: "external", opts: Options{MaxMemory: 64}, phase: PhaseMerge},
+		{name: "limit", opts: Options{Limit: 2}, phase: PhaseWrite},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := &Progress{}
+			tt.opts.Progress = progress
+
+			result, err := Sort(strings.NewReader("5\n\n4\n3\n2\n1\n"), io.Discard, tt.opts)
+			if err != nil {
+				t.Fatalf("Sort() error = %v", err)
+			}
+
+			if progress.Phase() != tt.phase || progress.Done() != int64(result.Written) {
+				t.Errorf("progress = %v phase, %d done; want %v phase, %d done",
+					progress.Phase(), progress.Done(), tt.phase, result.Written)
+			}
+		})
+	}
+}
+
+func TestSortLocale(t *testing.T) {
+	de := Locale{Grouping: '.', Decimal: ','}
+	en := Locale{Grouping: ',', Decimal: '.'}
+
+	tests := []sortTest{
+		{
+			name:  "leading plus",
+			input: "+5\n-2\n+0\n",
+			want:  "-2\n+0\n+5\n",
+		},
+		{
+			name:  "grouping and decimal comma",
+			input: "1.234.567,89\n-0,5\n12,5\n1.000\n",
+			opts:  Options{Type: Float64, InputLocale: de},
+			want:  "-0,5\n12,5\n1.000\n1.234.567,89\n",
+		},
+		{
+			name:  "currency codes and symbols",
+			input: "+12,50 EUR\n3USD\n-1.000 €\n$ 7\n",
+			opts:  Options{Type: Float64, InputLocale: de, StripCurrency: true},
+			want:  "-1.000 €\n3USD\n$ 7\n+12,50 EUR\n",
+		},
+		{
+			name:  "spaces as grouping",
+			input: "1 234,5\n1 000\n-2 000\n",
+			opts:  Options{Type: Float64, InputLocale: Locale{Grouping: ' ', Decimal: ','}},
+			want:  "-2 000\n1 000\n1 234,5\n",
+		},
+		{
+			name:  "grouped integers",
+			input: "1,000,000\n-12,345\n999\n",
+			opts:  Options{Type: Int64, InputLocale: en},
+			want:  "-12,345\n999\n1,000,000\n",
+		},
+		{
+			name:    "wrong locale",
+			input:   "1.5\n",
+			opts:    Options{Type: Float64, InputLocale: de},
+			wantErr: "invalid number '1.5' on line 1: invalid digit grouping",
+		},
+		{
+			name:    "short group",
+			input:   "1,00\n",
+			opts:    Options{InputLocale: en},
+			wantErr: "invalid digit grouping",
+		},
+		{
+			name:    "long first group",
+			input:   "1234,567\n",
+			opts:    Options{InputLocale: en},
+			wantErr: "invalid digit grouping",
+		},
+		{
+			name:    "currency not stripped",
+			input:   "5 EUR\n",
+			wantErr: "invalid number '5 EUR'",
+		},
+		{
+			name:    "same separators",
+			input:   "1\n",
+			opts:    Options{InputLocale: Locale{Grouping: ',', Decimal: ','}},
+			wantErr: "invalid input locale",
+		},
+		{
+			name:  "output grouping and decimals",
+			input: "1234567.891\n-1000\n0.5\n",
+			opts:  Options{Type: Float64, Output: &OutputStyle{Locale: de, Decimals: 2}},
+			want:  "-1.000,00\n0,50\n1.234.567,89\n",
+		},
+		{
+			name:  "output integers with decimals",
+			input: "1234\n-5\n",
+			opts:  Options{Output: &OutputStyle{Locale: en, Decimals: 2}},
+			want:  "-5.00\n1,234.00\n",
+		},
+		{
+			name:  "output shortest digits",
+			input: "1e6\n0.25\n",
+			opts:  Options{Type: Float64, Output: &OutputStyle{Locale: en, Decimals: -1}},
+			want:  "0.25\n1,000,000\n",
+		},
+		{
+			name:  "output padding",
+			input: "NaN\n12345\n-1\n",
+			opts:  Options{Type: Float64, Output: &OutputStyle{Locale: en, Decimals: -1, Pad: 8}},
+			want:  "      -1\n  12,345\n     NaN\n",
+		},
+		{
+			name:  "output bigint",
+			input: "123456789012345678901234567890\n",
+			opts:  Options{Type: BigInt, Output: &OutputStyle{Locale: Locale{Grouping: '\''}, Decimals: -1}},
+			want:  "123'456'789'012'345'678'901'234'567'890\n",
+		},
+		{
+			name:  "external round trip",
+			input: "1.000,5\n2,25\n-3\n",
+			opts:  Options{Type: Float64, InputLocale: de, Output: &OutputStyle{Locale: en, Decimals: 1}, MaxMemory: 1},
+			want:  "-3.0\n2.2\n1,000.5\n",
+		},
+	}
+
+	runSortTests(t, tests)
+}
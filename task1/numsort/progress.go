@@ -0,0 +1,97 @@
+package numsort
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// cancelCheckInterval is how many records are processed between checks for
+// cancellation
+const cancelCheckInterval = 1024
+
+// Phase is a stage of a run
+type Phase int32
+
+const (
+	PhaseRead  Phase = iota // reading and parsing the input
+	PhaseSort               // sorting records in memory
+	PhaseMerge              // merging sorted inputs or runs
+	PhaseWrite              // writing sorted records
+)
+
+var phaseNames = [...]string{"read", "sort", "merge", "write"}
+
+func (p Phase) String() string {
+	if p < 0 || int(p) >= len(phaseNames) {
+		return "unknown"
+	}
+	return phaseNames[p]
+}
+
+// Progress reports how far a run has got. Pass one in Options and read it
+// from another goroutine while the run is going on.
+type Progress struct {
+	phase atomic.Int32
+	done  atomic.Int64
+	total atomic.Int64
+}
+
+// Phase returns the current phase
+func (p *Progress) Phase() Phase {
+	return Phase(p.phase.Load())
+}
+
+// Done returns the number of records processed in the current phase
+func (p *Progress) Done() int64 {
+	return p.done.Load()
+}
+
+// Total returns the number of records the current phase will process, or 0
+// when that is not known in advance
+func (p *Progress) Total() int64 {
+	return p.total.Load()
+}
+
+// start enters phase, which will process total records. A nil Progress
+// ignores it.
+func (p *Progress) start(phase Phase, total int) {
+	if p == nil {
+		return
+	}
+	p.done.Store(0)
+	p.total.Store(int64(total))
+	p.phase.Store(int32(phase))
+}
+
+// add counts n records processed in the current phase. A nil Progress
+// ignores it.
+func (p *Progress) add(n int64) {
+	if p != nil {
+		p.done.Add(n)
+	}
+}
+
+// trackedSource counts the records of a source as progress and stops once
+// the context is cancelled
+type trackedSource struct {
+	recordSource
+	ctx      context.Context
+	progress *Progress
+	count    int
+}
+
+// Next returns the next record of the source
+func (ts *trackedSource) Next() (record, error) {
+	ts.count++
+	if ts.count%cancelCheckInterval == 0 {
+		if err := ts.ctx.Err(); err != nil {
+			return record{}, err
+		}
+	}
+
+	r, err := ts.recordSource.Next()
+	if err == nil {
+		ts.progress.add(1)
+	}
+	return r, err
+}
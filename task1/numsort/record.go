@@ -0,0 +1,251 @@
+package numsort
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errMissingField = errors.New("field is missing")
+
+// Key describes one sort key of a record
+type Key struct {
+	Field   int  // 1-based field index, 0 for the whole line
+	Numeric bool // compare as a number of the selected type instead of as text
+	Reverse bool // sort this key in descending order
+}
+
+// ParseKey parses a key of the form FIELD[n][r], e.g. "2", "3n" or "1nr",
+// following the key modifiers of Unix sort
+func ParseKey(value string) (Key, error) {
+	digits := strings.TrimRight(value, "nr")
+	field, err := strconv.Atoi(digits)
+	if err != nil || field < 1 {
+		return Key{}, fmt.Errorf("invalid key %q: want FIELD[n][r] with FIELD >= 1", value)
+	}
+
+	key := Key{Field: field}
+	for _, modifier := range value[len(digits):] {
+		switch modifier {
+		case 'n':
+			key.Numeric = true
+		case 'r':
+			key.Reverse = true
+		}
+	}
+
+	return key, nil
+}
+
+// record is one input line together with its parsed sort keys
+type record struct {
+	line string
+	keys []number
+}
+
+// parseError reports a key field that could not be parsed
+type parseError struct {
+	line  int
+	field int
+	text  string
+	err   error
+}
+
+func (e *parseError) Error() string {
+	if e.field == 0 {
+		return fmt.Sprintf("invalid number '%s' on line %d: %v", e.text, e.line, e.err)
+	}
+	return fmt.Sprintf("invalid key '%s' in field %d on line %d: %v", e.text, e.field, e.line, e.err)
+}
+
+func (e *parseError) Unwrap() error { return e.err }
+
+// recordFormat splits lines into fields, parses their keys and orders the
+// resulting records. Without explicit keys every line is a single number.
+type recordFormat struct {
+	numbers   numberFormat
+	keys      []Key
+	delimiter string // "" splits on runs of whitespace, "csv" honours CSV quoting
+	reverse   bool   // reverse the order of every key
+}
+
+// defaultKeys sorts whole lines as numbers
+var defaultKeys = []Key{{Field: 0, Numeric: true}}
+
+// wholeLine reports whether records are bare numbers rather than delimited
+// lines with key fields
+func (rf *recordFormat) wholeLine() bool {
+	return len(rf.keys) == 1 && rf.keys[0].Field == 0
+}
+
+// parse splits line into fields and parses its keys
+func (rf *recordFormat) parse(line string) (record, error) {
+	return rf.parseInto(line, make([]number, len(rf.keys)))
+}
+
+// parseInto is like parse but stores the keys in keys, which must have one
+// element per key
+func (rf *recordFormat) parseInto(line string, keys []number) (record, error) {
+	r := record{line: line, keys: keys}
+
+	var fields []string
+	if !rf.wholeLine() {
+		var err error
+		fields, err = rf.split(line)
+		if err != nil {
+			return r, err
+		}
+	}
+
+	for i, key := range rf.keys {
+		text := line
+		if key.Field > 0 {
+			text = ""
+			if key.Field <= len(fields) {
+				text = fields[key.Field-1]
+			}
+		}
+
+		if !key.Numeric {
+			r.keys[i] = number{text: text}
+			continue
+		}
+
+		text = strings.TrimSpace(text)
+		if text == "" {
+			return r, &parseError{field: key.Field, err: errMissingField}
+		}
+
+		num, err := rf.numbers.parse(text)
+		if err != nil {
+			return r, &parseError{field: key.Field, text: text, err: err}
+		}
+		r.keys[i] = num
+	}
+
+	return r, nil
+}
+
+// split breaks line into fields according to the delimiter
+func (rf *recordFormat) split(line string) ([]string, error) {
+	switch rf.delimiter {
+	case "":
+		return strings.Fields(line), nil
+	case "csv":
+		reader := csv.NewReader(strings.NewReader(line))
+		reader.FieldsPerRecord = -1
+		reader.LazyQuotes = true
+		fields, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		return fields, nil
+	default:
+		return strings.Split(line, rf.delimiter), nil
+	}
+}
+
+// compare orders a and b key by key, returning -1, 0 or +1
+func (rf *recordFormat) compare(a, b record) int {
+	for i, key := range rf.keys {
+		var c int
+		if key.Numeric {
+			c = rf.numbers.compare(&a.keys[i], &b.keys[i])
+		} else {
+			c = strings.Compare(a.keys[i].text, b.keys[i].text)
+		}
+
+		if key.Reverse != rf.reverse {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// format returns the text written to the output for r. Delimited records
+// are always written unchanged.
+func (rf *recordFormat) format(r record) string {
+	if rf.wholeLine() {
+		return rf.numbers.format(r.keys[0])
+	}
+	return r.line
+}
+
+// recordReader reads records from a stream, one per line, skipping empty
+// lines. With a reject log set, lines that fail to parse are logged and
+// skipped instead of ending the read.
+type recordReader struct {
+	scanner    *bufio.Scanner
+	format     recordFormat
+	lineNumber int
+	name       string
+	rejects    *rejectLog
+	keys       []number // free keys shared by the next records, see keySlabSize
+}
+
+// keySlabSize is how many records get their keys from one allocation, which
+// saves an allocation per record. A record kept on its own for long, as by
+// selectRecords, should take a copy of its keys so it does not hold on to
+// the whole slab.
+const keySlabSize = 256
+
+// newRecordReader creates a record reader over r that parses lines with rf
+func newRecordReader(r io.Reader, rf recordFormat) *recordReader {
+	return &recordReader{scanner: bufio.NewScanner(r), format: rf}
+}
+
+// Next returns the next record, or io.EOF once the input is exhausted
+func (rr *recordReader) Next() (record, error) {
+	for rr.scanner.Scan() {
+		rr.lineNumber++
+		line := rr.scanner.Text()
+
+		// Skip empty lines
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		// Bare numbers are trimmed; delimited lines are carried through as is
+		if rr.format.wholeLine() {
+			line = strings.TrimSpace(line)
+		}
+
+		n := len(rr.format.keys)
+		if len(rr.keys) < n {
+			rr.keys = make([]number, keySlabSize*n)
+		}
+		r, err := rr.format.parseInto(line, rr.keys[:n:n])
+		if err != nil {
+			var perr *parseError
+			if errors.As(err, &perr) {
+				perr.line = rr.lineNumber
+			} else {
+				err = fmt.Errorf("invalid line %d: %w", rr.lineNumber, err)
+			}
+
+			if rr.rejects == nil {
+				return record{}, err
+			}
+			if err := rr.rejects.add(rr.name, rr.lineNumber, rr.scanner.Text(), err); err != nil {
+				return record{}, err
+			}
+			continue
+		}
+
+		rr.keys = rr.keys[n:]
+		return r, nil
+	}
+
+	if err := rr.scanner.Err(); err != nil {
+		return record{}, fmt.Errorf("error reading file: %w", err)
+	}
+
+	return record{}, io.EOF
+}
@@ -0,0 +1,67 @@
+package numsort
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooManyRejects is returned by lenient runs that reject more lines than
+// Options.MaxRejectRatio allows
+var ErrTooManyRejects = errors.New("too many rejected lines")
+
+// rejectLog collects the lines skipped in lenient mode. Every rejected line
+// is written as "<name>:<line>\t<error>\t<text>". Writes are passed straight
+// through so the log is complete even when the run aborts.
+type rejectLog struct {
+	writer   io.Writer
+	maxRatio float64
+	count    int
+}
+
+// newRejectLog creates a reject log writing to w, discarding entries when w
+// is nil. Runs fail the error budget once more than maxRatio of their lines
+// are rejected.
+func newRejectLog(w io.Writer, maxRatio float64) *rejectLog {
+	if w == nil {
+		w = io.Discard
+	}
+	return &rejectLog{writer: w, maxRatio: maxRatio}
+}
+
+// add records a rejected line of the named input
+func (rl *rejectLog) add(name string, lineNumber int, line string, err error) error {
+	rl.count++
+	if _, werr := fmt.Fprintf(rl.writer, "%s:%d\t%v\t%s\n", name, lineNumber, err, line); werr != nil {
+		return fmt.Errorf("failed to write rejected line: %w", werr)
+	}
+	return nil
+}
+
+// check fails if the rejected lines exceed the error budget, given how many
+// lines were accepted. A nil log never fails.
+func (rl *rejectLog) check(accepted int) error {
+	if rl == nil {
+		return nil
+	}
+
+	total := accepted + rl.count
+	if total == 0 {
+		return nil
+	}
+
+	ratio := float64(rl.count) / float64(total)
+	if ratio > rl.maxRatio {
+		return fmt.Errorf("%w: %d of %d (%.2f%%), more than the allowed %.2f%%",
+			ErrTooManyRejects, rl.count, total, ratio*100, rl.maxRatio*100)
+	}
+	return nil
+}
+
+// rejected returns the number of rejected lines. A nil log has none.
+func (rl *rejectLog) rejected() int {
+	if rl == nil {
+		return 0
+	}
+	return rl.count
+}
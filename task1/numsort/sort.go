@@ -0,0 +1,318 @@
+package numsort
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+)
+
+const (
+	// minParallelSize is the smallest slice worth splitting across workers
+	minParallelSize = 1 << 14
+
+	// insertionSortSize is the block length sorted by insertion sort before
+	// merge sort takes over
+	insertionSortSize = 24
+)
+
+// sortRecords stably sorts records using up to workers goroutines. The slice
+// is split into one part per worker, the parts are sorted concurrently and
+// then merged pairwise. Bare integers take a radix sort fast path, which
+// splits the work by key range instead. The sorted records are returned,
+// in records or in a new slice of the same length, which saves copying them
+// back. ctx is checked between passes; once it is done the records are left
+// in an unspecified order and its error is returned.
+func sortRecords(ctx context.Context, records []record, rf recordFormat, workers int) ([]record, error) {
+	workers = max(1, min(workers, len(records)/minParallelSize))
+	if rf.radixSortable() {
+		return radixSort(ctx, records, rf.reverse != rf.keys[0].Reverse, workers)
+	}
+
+	scratch := make([]record, len(records))
+	if workers == 1 {
+		return records, mergeSort(ctx, records, scratch, &rf)
+	}
+
+	// Sort one part per worker
+	bounds := make([]int, workers+1)
+	for i := range bounds {
+		bounds[i] = i * len(records) / workers
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			// A canceled part is reported by the ctx check below
+			mergeSort(ctx, records[lo:hi], scratch[lo:hi], &rf)
+		}(bounds[i], bounds[i+1])
+	}
+	wg.Wait()
+
+	// Merge neighbouring parts until one remains, alternating between the
+	// records and the scratch buffer
+	src, dst := records, scratch
+	for len(bounds) > 2 {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		next := []int{0}
+		for i := 0; i+1 < len(bounds); i += 2 {
+			lo, mid, hi := bounds[i], bounds[i+1], bounds[i+1]
+			if i+2 < len(bounds) {
+				hi = bounds[i+2]
+			}
+			next = append(next, hi)
+
+			wg.Add(1)
+			go func(lo, mid, hi int) {
+				defer wg.Done()
+				mergeParts(dst[lo:hi], src[lo:mid], src[mid:hi], &rf)
+			}(lo, mid, hi)
+		}
+		wg.Wait()
+
+		src, dst = dst, src
+		bounds = next
+	}
+
+	return src, ctx.Err()
+}
+
+// mergeSort stably sorts records with a bottom-up merge sort, using scratch
+// (of the same length) as the merge buffer. It stops between passes once ctx
+// is done.
+func mergeSort(ctx context.Context, records, scratch []record, rf *recordFormat) error {
+	n := len(records)
+
+	// Insertion sort short blocks
+	for lo := 0; lo < n; lo += insertionSortSize {
+		hi := min(lo+insertionSortSize, n)
+		for i := lo + 1; i < hi; i++ {
+			for j := i; j > lo && rf.compare(records[j], records[j-1]) < 0; j-- {
+				records[j], records[j-1] = records[j-1], records[j]
+			}
+		}
+	}
+
+	// Merge blocks of doubling width, alternating between the two buffers
+	src, dst := records, scratch
+	for width := insertionSortSize; width < n; width *= 2 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for lo := 0; lo < n; lo += 2 * width {
+			mid := min(lo+width, n)
+			hi := min(lo+2*width, n)
+			mergeParts(dst[lo:hi], src[lo:mid], src[mid:hi], rf)
+		}
+		src, dst = dst, src
+	}
+
+	if n > 0 && &src[0] != &records[0] {
+		copy(records, src)
+	}
+	return nil
+}
+
+// mergeParts merges the sorted slices left and right into dst. Equal records
+// are taken from left first so the merge is stable.
+func mergeParts(dst, left, right []record, rf *recordFormat) {
+	i, j, k := 0, 0, 0
+	for i < len(left) && j < len(right) {
+		if rf.compare(right[j], left[i]) < 0 {
+			dst[k] = right[j]
+			j++
+		} else {
+			dst[k] = left[i]
+			i++
+		}
+		k++
+	}
+	k += copy(dst[k:], left[i:])
+	copy(dst[k:], right[j:])
+}
+
+// radixSortable reports whether records are bare integers that can be
+// ordered by their int64 value alone
+func (rf *recordFormat) radixSortable() bool {
+	typ := rf.numbers.typ
+	return rf.wholeLine() && (typ == Int || typ == Int64)
+}
+
+// radixEntry pairs a record's radix key with its position in the input
+type radixEntry struct {
+	key   uint64
+	index int
+}
+
+const (
+	// Radix sort digits are 11 bits wide, so that six passes cover an int64
+	// and the counts of a digit stay in the L1 cache
+	radixBits    = 11
+	radixPasses  = (64 + radixBits - 1) / radixBits
+	radixBuckets = 1 << radixBits
+	radixMask    = radixBuckets - 1
+
+	// radixMinBucket is the smallest bucket sorted by its remaining digits;
+	// smaller ones are cheaper to sort by comparison
+	radixMinBucket = 256
+)
+
+// radixCounts holds the number of keys with each value of each digit
+type radixCounts [radixPasses][radixBuckets]int
+
+// radixSort stably sorts bare integer records with a radix sort over the
+// digits of their int64 keys, skipping digits that are the same for every
+// record. The keys are first split into buckets on their most significant
+// varying digit, and the buckets then sorted on the digits below it by up to
+// workers goroutines, so no merge is needed. Only compact key/index pairs
+// are moved while sorting; each record is moved once at the end, into the
+// new slice returned. It stops between buckets once ctx is done.
+func radixSort(ctx context.Context, records []record, descending bool, workers int) ([]record, error) {
+	n := len(records)
+	if n < 2 {
+		return records, nil
+	}
+
+	// Flipping the sign bit maps int64 order onto uint64 order, and
+	// complementing that reverses it
+	src := make([]radixEntry, n)
+	for i := range records {
+		key := uint64(records[i].keys[0].i) ^ (1 << 63)
+		if descending {
+			key = ^key
+		}
+		src[i] = radixEntry{key: key, index: i}
+	}
+	all := make([]int, radixPasses)
+	for pass := range all {
+		all[pass] = pass
+	}
+	var counts radixCounts
+	passes := countDigits(src, &counts, all)
+	if len(passes) == 0 {
+		return records, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Split the keys on the top varying digit into buckets that follow each
+	// other in order
+	top, lower := passes[len(passes)-1], passes[:len(passes)-1]
+	dst := make([]radixEntry, n)
+	bounds := make([]int, 0, radixBuckets+1)
+	offset := 0
+	for digit, count := range counts[top] {
+		if count > 0 {
+			bounds = append(bounds, offset)
+		}
+		counts[top][digit] = offset
+		offset += count
+	}
+	bounds = append(bounds, n)
+	scatter(src, dst, top, &counts[top])
+
+	// Sort the buckets concurrently, each worker gathering the records of
+	// its buckets in order
+	sorted := make([]record, n)
+	buckets := make(chan int, len(bounds)-1)
+	for i := 0; i+1 < len(bounds); i++ {
+		buckets <- i
+	}
+	close(buckets)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var counts radixCounts
+			for i := range buckets {
+				if ctx.Err() != nil {
+					return
+				}
+				lo, hi := bounds[i], bounds[i+1]
+				bucket := sortBucket(dst[lo:hi], src[lo:hi], &counts, lower)
+				for j, entry := range bucket {
+					sorted[lo+j] = records[entry.index]
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return sorted, nil
+}
+
+// digit returns the digit of key sorted in pass
+func digit(key uint64, pass int) int {
+	return int(key >> (pass * radixBits) & radixMask)
+}
+
+// countDigits fills counts with the digits of entries in the given passes
+// and returns those of the passes whose digit is not the same for every
+// entry
+func countDigits(entries []radixEntry, counts *radixCounts, passes []int) []int {
+	for _, pass := range passes {
+		clear(counts[pass][:])
+	}
+	for _, entry := range entries {
+		for _, pass := range passes {
+			counts[pass][digit(entry.key, pass)]++
+		}
+	}
+
+	var varying []int
+	for _, pass := range passes {
+		if counts[pass][digit(entries[0].key, pass)] != len(entries) {
+			varying = append(varying, pass)
+		}
+	}
+	return varying
+}
+
+// scatter stably moves src into dst by their digit in pass, where offsets
+// holds the start of each digit's entries in dst and is advanced past them
+func scatter(src, dst []radixEntry, pass int, offsets *[radixBuckets]int) {
+	for _, entry := range src {
+		d := digit(entry.key, pass)
+		dst[offsets[d]] = entry
+		offsets[d]++
+	}
+}
+
+// sortBucket stably sorts a bucket of entries by the digits of the given
+// passes, using scratch of the same length, and returns whichever of the
+// two holds the result
+func sortBucket(bucket, scratch []radixEntry, counts *radixCounts, passes []int) []radixEntry {
+	if len(bucket) < radixMinBucket {
+		// Entries are in input order within the bucket, so ties on the key
+		// are broken by the index
+		slices.SortFunc(bucket, func(a, b radixEntry) int {
+			if a.key != b.key {
+				return cmp.Compare(a.key, b.key)
+			}
+			return cmp.Compare(a.index, b.index)
+		})
+		return bucket
+	}
+
+	src, dst := bucket, scratch
+	for _, pass := range countDigits(bucket, counts, passes) {
+		offset := 0
+		for digit, count := range counts[pass] {
+			counts[pass][digit] = offset
+			offset += count
+		}
+		scatter(src, dst, pass, &counts[pass])
+		src, dst = dst, src
+	}
+	return src
+}
@@ -0,0 +1,263 @@
+package numsort
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const benchmarkSize = 1 << 20
+
+// benchmarkInts returns the same pseudo-random integers on every call
+func benchmarkInts() []int {
+	rng := rand.New(rand.NewSource(1))
+	numbers := make([]int, benchmarkSize)
+	for i := range numbers {
+		numbers[i] = rng.Int() - rng.Int()
+	}
+	return numbers
+}
+
+// benchmarkRecords parses benchmarkInts into records with rf
+func benchmarkRecords(b *testing.B, rf recordFormat) []record {
+	numbers := benchmarkInts()
+	records := make([]record, len(numbers))
+	for i, num := range numbers {
+		r, err := rf.parse(strconv.Itoa(num))
+		if err != nil {
+			b.Fatal(err)
+		}
+		records[i] = r
+	}
+	return records
+}
+
+// BenchmarkSortInts measures the original sort.Ints path
+func BenchmarkSortInts(b *testing.B) {
+	numbers := benchmarkInts()
+	work := make([]int, len(numbers))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(work, numbers)
+		b.StartTimer()
+		sort.Ints(work)
+	}
+}
+
+func benchmarkSortRecords(b *testing.B, rf recordFormat, workers int) {
+	records := benchmarkRecords(b, rf)
+	work := make([]record, len(records))
+	var sorted []record
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(work, records)
+		b.StartTimer()
+		sorted, _ = sortRecords(context.Background(), work, rf, workers)
+	}
+	b.StopTimer()
+
+	if !slices.IsSortedFunc(sorted, rf.compare) {
+		b.Fatal("records are not sorted")
+	}
+}
+
+// BenchmarkSortRecordsStable measures the records sorted the way sort.Ints
+// sorts numbers, with one stable comparison sort on a single goroutine
+func BenchmarkSortRecordsStable(b *testing.B) {
+	rf := recordFormat{keys: defaultKeys}
+	records := benchmarkRecords(b, rf)
+	work := make([]record, len(records))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		copy(work, records)
+		b.StartTimer()
+		slices.SortStableFunc(work, rf.compare)
+	}
+}
+
+// Radix sort fast path for bare integers
+func BenchmarkSortRecordsRadix(b *testing.B) {
+	benchmarkSortRecords(b, recordFormat{keys: defaultKeys}, 1)
+}
+
+func BenchmarkSortRecordsRadixParallel(b *testing.B) {
+	benchmarkSortRecords(b, recordFormat{keys: defaultKeys}, runtime.NumCPU())
+}
+
+// Comparison sort, as used for floats and key fields
+func BenchmarkSortRecordsCompare(b *testing.B) {
+	benchmarkSortRecords(b, recordFormat{numbers: numberFormat{typ: Float64}, keys: defaultKeys}, 1)
+}
+
+func BenchmarkSortRecordsCompareParallel(b *testing.B) {
+	benchmarkSortRecords(b, recordFormat{numbers: numberFormat{typ: Float64}, keys: defaultKeys}, runtime.NumCPU())
+}
+
+// benchmarkInput returns benchmarkInts as lines of text
+func benchmarkInput() []byte {
+	var input []byte
+	for _, num := range benchmarkInts() {
+		input = strconv.AppendInt(input, int64(num), 10)
+		input = append(input, '\n')
+	}
+	return input
+}
+
+// BenchmarkPipelineSortInts measures the original pipeline end to end:
+// scanning lines, parsing them with strconv.Atoi, sort.Ints and writing the
+// numbers back out
+func BenchmarkPipelineSortInts(b *testing.B) {
+	input := benchmarkInput()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var numbers []int
+		scanner := bufio.NewScanner(bytes.NewReader(input))
+		for scanner.Scan() {
+			num, err := strconv.Atoi(scanner.Text())
+			if err != nil {
+				b.Fatal(err)
+			}
+			numbers = append(numbers, num)
+		}
+		sort.Ints(numbers)
+
+		w := bufio.NewWriter(io.Discard)
+		for _, num := range numbers {
+			w.WriteString(strconv.Itoa(num))
+			w.WriteByte('\n')
+		}
+		w.Flush()
+	}
+}
+
+func benchmarkPipeline(b *testing.B, opts Options) {
+	input := benchmarkInput()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Sort(bytes.NewReader(input), io.Discard, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Sort end to end, reading, sorting and writing the same lines
+func BenchmarkPipelineRadix(b *testing.B) {
+	benchmarkPipeline(b, Options{Workers: 1})
+}
+
+func BenchmarkPipelineRadixParallel(b *testing.B) {
+	benchmarkPipeline(b, Options{Workers: runtime.NumCPU()})
+}
+
+func TestSortRecordsStable(t *testing.T) {
+	// Half the keys come from a few wide-ranging values, spread over many
+	// radix buckets, and half from a narrow range that fills a few large
+	// ones; either way each key is repeated many times
+	rng := rand.New(rand.NewSource(1))
+	wide := make([]int64, 1000)
+	for i := range wide {
+		wide[i] = rng.Int63() - rng.Int63()
+	}
+	keys := make([]int64, 3*minParallelSize)
+	for i := range keys {
+		if i%2 == 0 {
+			keys[i] = wide[rng.Intn(len(wide))]
+		} else {
+			keys[i] = rng.Int63n(1000) - 500
+		}
+	}
+
+	// Equal integers are told apart by their leading zeros
+	padded := func(i int, key int64) string {
+		text := strings.Repeat("0", i%4) + strconv.FormatUint(uint64(max(key, -key)), 10)
+		if key < 0 {
+			return "-" + text
+		}
+		return text
+	}
+
+	tests := []struct {
+		name  string
+		opts  Options
+		radix bool
+		line  func(i int, key int64) string
+	}{
+		{
+			name:  "radix",
+			opts:  Options{},
+			radix: true,
+			line:  padded,
+		},
+		{
+			name:  "radix descending",
+			opts:  Options{Order: Descending},
+			radix: true,
+			line:  padded,
+		},
+		{
+			name: "compare",
+			opts: Options{Keys: []Key{{Field: 1}}},
+			line: func(i int, key int64) string {
+				return "line" + strconv.Itoa(i) + " " + strconv.FormatInt(key, 10)
+			},
+		},
+		{
+			name: "compare descending",
+			opts: Options{Type: Float64, Keys: []Key{{Field: 1}}, Order: Descending},
+			line: func(i int, key int64) string {
+				return "line" + strconv.Itoa(i) + " " + strconv.FormatInt(key, 10)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input strings.Builder
+			for i, key := range keys {
+				input.WriteString(tt.line(i, key))
+				input.WriteByte('\n')
+			}
+
+			tt.opts.Workers = 4
+			so, err := newSortOptions(context.Background(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if so.format.radixSortable() != tt.radix {
+				t.Fatalf("radixSortable() = %t, want %t", !tt.radix, tt.radix)
+			}
+			records, err := readRecords(strings.NewReader(input.String()), so)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := slices.Clone(records)
+			slices.SortStableFunc(want, so.format.compare)
+
+			got, err := sortRecords(context.Background(), records, so.format, so.workers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range want {
+				if got[i].line != want[i].line {
+					t.Fatalf("record %d is %q, want %q", i, got[i].line, want[i].line)
+				}
+			}
+		})
+	}
+}
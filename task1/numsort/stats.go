@@ -0,0 +1,227 @@
+package numsort
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// histogramWidth is the length of the longest histogram bar in text reports
+const histogramWidth = 50
+
+// Percentile is one requested percentile and its value
+type Percentile struct {
+	P     float64 `json:"p"`
+	Value float64 `json:"value"`
+}
+
+// Bucket is one equal-width histogram bucket covering [Low, High)
+type Bucket struct {
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	Count int     `json:"count"`
+}
+
+// Stats describes the finite values of the primary numeric key. NaN
+// and infinite values are only counted.
+type Stats struct {
+	Count       int          `json:"count"`
+	NaN         int          `json:"nan"`
+	Infinite    int          `json:"infinite"`
+	Min         float64      `json:"min"`
+	Max         float64      `json:"max"`
+	Mean        float64      `json:"mean"`
+	Median      float64      `json:"median"`
+	Mode        float64      `json:"mode"`
+	ModeCount   int          `json:"modeCount"`
+	StdDev      float64      `json:"stdDev"`
+	Percentiles []Percentile `json:"percentiles,omitempty"`
+	Histogram   []Bucket     `json:"histogram,omitempty"`
+}
+
+// statsKey returns the index of the key that statistics are computed over:
+// the first numeric key
+func (rf *recordFormat) statsKey() (int, error) {
+	for i, key := range rf.keys {
+		if key.Numeric {
+			return i, nil
+		}
+	}
+	return 0, errors.New("statistics need a numeric sort key")
+}
+
+// keyValues converts the statistics key of every record to float64
+func keyValues(records []record, rf *recordFormat) ([]float64, error) {
+	index, err := rf.statsKey()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]float64, len(records))
+	for i := range records {
+		n := &records[i].keys[index]
+		switch {
+		case n.nan:
+			values[i] = math.NaN()
+		case rf.numbers.typ == Float64:
+			values[i] = n.f
+		case rf.numbers.typ == BigInt:
+			values[i], _ = new(big.Float).SetInt(n.b).Float64()
+		case rf.numbers.typ == BigFloat:
+			values[i], _ = n.bf.Float64()
+		default:
+			values[i] = float64(n.i)
+		}
+	}
+	return values, nil
+}
+
+// computeStats summarizes values. It reorders values in place.
+func computeStats(values []float64, percentiles []float64, buckets int) Stats {
+	var stats Stats
+
+	// Keep the finite values in ascending order
+	finite := values[:0]
+	for _, v := range values {
+		switch {
+		case math.IsNaN(v):
+			stats.NaN++
+		case math.IsInf(v, 0):
+			stats.Infinite++
+		default:
+			finite = append(finite, v)
+		}
+	}
+	sort.Float64s(finite)
+
+	stats.Count = len(finite)
+	if stats.Count == 0 {
+		return stats
+	}
+
+	stats.Min = finite[0]
+	stats.Max = finite[len(finite)-1]
+	stats.Median = percentileOf(finite, 50)
+
+	// Mean and standard deviation using Welford's algorithm
+	var mean, m2 float64
+	for i, v := range finite {
+		delta := v - mean
+		mean += delta / float64(i+1)
+		m2 += delta * (v - mean)
+	}
+	stats.Mean = mean
+	stats.StdDev = math.Sqrt(m2 / float64(len(finite)))
+
+	// The mode is the longest run of equal values, the smallest value on ties
+	for start := 0; start < len(finite); {
+		end := start + 1
+		for end < len(finite) && finite[end] == finite[start] {
+			end++
+		}
+		if end-start > stats.ModeCount {
+			stats.Mode = finite[start]
+			stats.ModeCount = end - start
+		}
+		start = end
+	}
+
+	for _, p := range percentiles {
+		stats.Percentiles = append(stats.Percentiles, Percentile{P: p, Value: percentileOf(finite, p)})
+	}
+
+	stats.Histogram = histogram(finite, buckets)
+
+	return stats
+}
+
+// percentileOf returns the p-th percentile of sorted values, interpolating
+// linearly between the closest ranks
+func percentileOf(sorted []float64, p float64) float64 {
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// histogram counts sorted values into equal-width buckets spanning their
+// range. The maximum value falls into the last bucket.
+func histogram(sorted []float64, buckets int) []Bucket {
+	if buckets < 1 {
+		return nil
+	}
+
+	lo, hi := sorted[0], sorted[len(sorted)-1]
+	if lo == hi {
+		return []Bucket{{Low: lo, High: hi, Count: len(sorted)}}
+	}
+
+	width := (hi - lo) / float64(buckets)
+	result := make([]Bucket, buckets)
+	for i := range result {
+		result[i].Low = lo + float64(i)*width
+		result[i].High = lo + float64(i+1)*width
+	}
+	result[buckets-1].High = hi
+
+	for _, v := range sorted {
+		i := min(int((v-lo)/width), buckets-1)
+		result[i].Count++
+	}
+
+	return result
+}
+
+// WriteStatsText writes stats as a human-readable report
+func WriteStatsText(w io.Writer, stats Stats) error {
+	var b strings.Builder
+
+	b.WriteString("=== Statistics ===\n")
+	fmt.Fprintf(&b, "Count: %d\n", stats.Count)
+	if stats.NaN > 0 {
+		fmt.Fprintf(&b, "NaN values (excluded): %d\n", stats.NaN)
+	}
+	if stats.Infinite > 0 {
+		fmt.Fprintf(&b, "Infinite values (excluded): %d\n", stats.Infinite)
+	}
+
+	if stats.Count > 0 {
+		fmt.Fprintf(&b, "Min: %g\n", stats.Min)
+		fmt.Fprintf(&b, "Max: %g\n", stats.Max)
+		fmt.Fprintf(&b, "Mean: %g\n", stats.Mean)
+		fmt.Fprintf(&b, "Median: %g\n", stats.Median)
+		fmt.Fprintf(&b, "Mode: %g (%d times)\n", stats.Mode, stats.ModeCount)
+		fmt.Fprintf(&b, "Standard deviation: %g\n", stats.StdDev)
+		for _, p := range stats.Percentiles {
+			fmt.Fprintf(&b, "P%g: %g\n", p.P, p.Value)
+		}
+	}
+
+	if len(stats.Histogram) > 0 {
+		b.WriteString("\n=== Histogram ===\n")
+
+		largest := 0
+		for _, bk := range stats.Histogram {
+			largest = max(largest, bk.Count)
+		}
+		for _, bk := range stats.Histogram {
+			bar := strings.Repeat("#", bk.Count*histogramWidth/largest)
+			fmt.Fprintf(&b, "[%12.6g, %12.6g) %10d %s\n", bk.Low, bk.High, bk.Count, bar)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteStatsJSON writes stats as an indented JSON document
+func WriteStatsJSON(w io.Writer, stats Stats) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
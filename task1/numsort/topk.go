@@ -0,0 +1,83 @@
+package numsort
+
+import (
+	"container/heap"
+	"io"
+	"slices"
+)
+
+// selectEntry is a record kept by a selection together with its input
+// position, which breaks ties so the selection is stable
+type selectEntry struct {
+	record record
+	index  int
+}
+
+// selectHeap holds the best records seen so far in sort order, with the
+// worst of them at the root so it can be replaced cheaply
+type selectHeap struct {
+	entries []selectEntry
+	format  *recordFormat
+}
+
+func (h *selectHeap) Len() int { return len(h.entries) }
+
+func (h *selectHeap) Less(i, j int) bool {
+	if c := h.format.compare(h.entries[i].record, h.entries[j].record); c != 0 {
+		return c > 0
+	}
+	return h.entries[i].index > h.entries[j].index
+}
+
+func (h *selectHeap) Swap(i, j int) { h.entries[i], h.entries[j] = h.entries[j], h.entries[i] }
+
+func (h *selectHeap) Push(x any) { h.entries = append(h.entries, x.(selectEntry)) }
+
+func (h *selectHeap) Pop() any {
+	n := len(h.entries)
+	entry := h.entries[n-1]
+	h.entries[n-1] = selectEntry{}
+	h.entries = h.entries[:n-1]
+	return entry
+}
+
+// selectRecords streams r once and returns the first k records of its sort
+// order, sorted, holding no more than k records at a time. Equal records
+// keep their input order. It also returns the number of records read.
+func selectRecords(r io.Reader, opts sortOptions, k int) ([]record, int, error) {
+	source := opts.newSource(r, opts.name)
+
+	h := &selectHeap{format: &opts.format}
+	count := 0
+	for {
+		rec, err := source.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// A later record only displaces the root if it sorts strictly
+		// before it, so equal records keep their input order
+		entry := selectEntry{record: rec, index: count}
+		count++
+		switch {
+		case h.Len() < k:
+			entry.record.keys = slices.Clone(rec.keys)
+			heap.Push(h, entry)
+		case opts.format.compare(rec, h.entries[0].record) < 0:
+			entry.record.keys = slices.Clone(rec.keys)
+			h.entries[0] = entry
+			heap.Fix(h, 0)
+		}
+	}
+
+	// Popping yields the worst record first
+	records := make([]record, h.Len())
+	for i := len(records) - 1; i >= 0; i-- {
+		records[i] = heap.Pop(h).(selectEntry).record
+	}
+
+	return records, count, nil
+}
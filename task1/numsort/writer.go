@@ -0,0 +1,108 @@
+package numsort
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Dedup selects how runs of equal records are written
+type Dedup int
+
+const (
+	KeepAll    Dedup = iota // write every record
+	Unique                  // write the first record of every run
+	Count                   // write the first record of every run and its length
+	Duplicates              // write the first record of runs longer than one
+)
+
+// recordWriter writes sorted records as lines. Records that compare equal
+// form a run, which is collapsed according to the dedup mode; without one
+// every record is written as it arrives.
+type recordWriter struct {
+	writer  *bufio.Writer
+	format  *recordFormat
+	mode    Dedup
+	layout  *binaryLayout // packed binary output, nil for text
+	current record
+	run     int
+	written int
+}
+
+// newRecordWriter creates a record writer over w that writes in the output
+// format of opts
+func newRecordWriter(w io.Writer, opts *sortOptions) *recordWriter {
+	rw := &recordWriter{writer: bufio.NewWriter(w), format: &opts.format, mode: opts.dedup}
+	if opts.output == BinaryFormat {
+		rw.layout = &opts.layout
+	}
+	return rw
+}
+
+// Write adds the next record in sorted order
+func (rw *recordWriter) Write(r record) error {
+	if rw.mode == KeepAll {
+		return rw.emit(r)
+	}
+
+	if rw.run > 0 && rw.format.compare(rw.current, r) == 0 {
+		rw.run++
+		return nil
+	}
+
+	if err := rw.endRun(); err != nil {
+		return err
+	}
+	rw.current = r
+	rw.run = 1
+	return nil
+}
+
+// Flush writes the pending run and flushes the buffered output
+func (rw *recordWriter) Flush() error {
+	if err := rw.endRun(); err != nil {
+		return err
+	}
+	rw.run = 0
+	return rw.writer.Flush()
+}
+
+// endRun writes the current run of equal records
+func (rw *recordWriter) endRun() error {
+	if rw.run == 0 {
+		return nil
+	}
+
+	switch rw.mode {
+	case Count:
+		return rw.writeLine(rw.format.format(rw.current) + " " + strconv.Itoa(rw.run))
+	case Duplicates:
+		if rw.run == 1 {
+			return nil
+		}
+	}
+	return rw.emit(rw.current)
+}
+
+// emit writes r in the output format
+func (rw *recordWriter) emit(r record) error {
+	if rw.layout == nil {
+		return rw.writeLine(rw.format.format(r))
+	}
+
+	rw.written++
+	if err := writeBinary(rw.writer, r, *rw.layout); err != nil {
+		return fmt.Errorf("failed to write value %s: %w", r.line, err)
+	}
+	return nil
+}
+
+// writeLine writes text followed by a newline
+func (rw *recordWriter) writeLine(text string) error {
+	rw.written++
+	if err := writeLine(rw.writer, text); err != nil {
+		return fmt.Errorf("failed to write line %s: %w", text, err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"task1/numsort"
+)
+
+// progressReporter prints the progress of a run to stderr at a fixed
+// interval until it is stopped
+type progressReporter struct {
+	progress *numsort.Progress
+	inputs   []*input
+	interval time.Duration
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// startProgress starts reporting progress, reading bytes from inputs
+func startProgress(progress *numsort.Progress, inputs []*input, interval time.Duration) *progressReporter {
+	pr := &progressReporter{
+		progress: progress,
+		inputs:   inputs,
+		interval: interval,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go pr.run()
+	return pr
+}
+
+// Stop stops reporting and waits for the last report to be printed. A nil
+// reporter does nothing.
+func (pr *progressReporter) Stop() {
+	if pr == nil {
+		return
+	}
+	close(pr.stop)
+	<-pr.stopped
+}
+
+func (pr *progressReporter) run() {
+	defer close(pr.stopped)
+
+	ticker := time.NewTicker(pr.interval)
+	defer ticker.Stop()
+
+	phase := pr.progress.Phase()
+	phaseStart := time.Now()
+	for {
+		select {
+		case <-pr.stop:
+			return
+		case now := <-ticker.C:
+			if current := pr.progress.Phase(); current != phase {
+				phase, phaseStart = current, now
+			}
+			fmt.Fprintln(os.Stderr, pr.report(phase, now.Sub(phaseStart)))
+		}
+	}
+}
+
+// report describes the progress of phase, which has been running for
+// elapsed. The ETA extrapolates the rate of the phase so far.
+func (pr *progressReporter) report(phase numsort.Phase, elapsed time.Duration) string {
+	done, total := pr.progress.Done(), pr.progress.Total()
+
+	// The total size is unknown if any input, such as stdin, has no size
+	var read, size int64
+	sizeKnown := true
+	for _, in := range pr.inputs {
+		read += in.BytesRead()
+		size += in.size
+		if in.size == 0 {
+			sizeKnown = false
+		}
+	}
+	if !sizeKnown {
+		size = -1
+	}
+
+	parts := []string{fmt.Sprintf("progress: %s phase", phase)}
+	fraction := -1.0
+
+	switch {
+	case phase == numsort.PhaseSort:
+		parts = append(parts, fmt.Sprintf("sorting %d records", total))
+	case total > 0:
+		fraction = float64(done) / float64(total)
+		parts = append(parts, fmt.Sprintf("%d of %d records (%.1f%%)", done, total, fraction*100))
+	case phase == numsort.PhaseRead || phase == numsort.PhaseMerge:
+		if size > 0 {
+			fraction = float64(read) / float64(size)
+			parts = append(parts, fmt.Sprintf("%s of %s read (%.1f%%)", formatBytes(read), formatBytes(size), fraction*100))
+		} else {
+			parts = append(parts, formatBytes(read)+" read")
+		}
+		parts = append(parts, fmt.Sprintf("%d lines parsed", done))
+	default:
+		parts = append(parts, fmt.Sprintf("%d records", done))
+	}
+
+	if fraction > 0 && fraction < 1 {
+		eta := time.Duration(float64(elapsed) * (1 - fraction) / fraction)
+		parts = append(parts, "ETA "+eta.Round(time.Second).String())
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// formatBytes formats n as MiB with one decimal
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+}
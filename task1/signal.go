@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// interruptHandler cancels a context on the first SIGINT or SIGTERM so a run
+// can stop and clean up after itself
+type interruptHandler struct {
+	ctx    context.Context
+	signal os.Signal // the signal received, set before ctx is cancelled
+}
+
+// handleInterrupts starts watching for SIGINT and SIGTERM. After the first
+// one the default handling is restored, so a second signal terminates the
+// process at once.
+func handleInterrupts() *interruptHandler {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &interruptHandler{ctx: ctx}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		h.signal = <-signals
+		signal.Stop(signals)
+		cancel()
+	}()
+
+	return h
+}
+
+// exitIfInterrupted exits if a signal was received, with 128 plus the
+// signal number like a shell reports a process killed by that signal. The
+// caller must already have removed partial output.
+func (h *interruptHandler) exitIfInterrupted() {
+	if h.ctx.Err() == nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Interrupted by %v, partial output removed\n", h.signal)
+	code := 128 + int(syscall.SIGINT)
+	if sig, ok := h.signal.(syscall.Signal); ok {
+		code = 128 + int(sig)
+	}
+	os.Exit(code)
+}
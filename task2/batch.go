@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// patternList collects repeated -include or -exclude glob patterns
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	if _, err := filepath.Match(value, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", value, err)
+	}
+	*p = append(*p, value)
+	return nil
+}
+
+// matchAny reports whether name matches any of the patterns
+func (p patternList) matchAny(name string) bool {
+	for _, pattern := range p {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileFilter selects the files found in directories and by glob patterns by
+// their base name. Files named explicitly are always counted.
+type fileFilter struct {
+	include patternList
+	exclude patternList
+}
+
+// accepts reports whether a found file is counted
+func (f *fileFilter) accepts(path string) bool {
+	name := filepath.Base(path)
+	if f.exclude.matchAny(name) {
+		return false
+	}
+	return len(f.include) == 0 || f.include.matchAny(name)
+}
+
+// collectFiles expands paths into a sorted list of distinct files.
+// Directories are walked recursively and glob patterns are expanded; both
+// are filtered. Excluded directories are not descended into.
+func collectFiles(paths []string, filter *fileFilter) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, path := range paths {
+		matches := []string{path}
+		isGlob := strings.ContainsAny(path, "*?[")
+		if isGlob {
+			var err error
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match %s", path)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case info.IsDir():
+				if err := walkDir(match, filter, add); err != nil {
+					return nil, err
+				}
+			case !isGlob || filter.accepts(match):
+				add(match)
+			}
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// walkDir passes every file below dir that the filter accepts to add
+func walkDir(dir string, filter *fileFilter, add func(string)) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if path != dir && filter.exclude.matchAny(entry.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.Type().IsRegular() && filter.accepts(path) {
+			add(path)
+		}
+		return nil
+	})
+}
+
+// fileResult is the outcome of counting one file
+type fileResult struct {
+	name   string
+	counts *charCounts
+	err    error
+}
+
+// countFiles counts files with a pool of workers. Results are returned in
+// the order of files, however the work was scheduled.
+func countFiles(files []string, workers int, opts *countOptions) []fileResult {
+	results := make([]fileResult, len(files))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(files)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				counts, err := countFile(files[i], opts)
+				results[i] = fileResult{name: files[i], counts: counts, err: err}
+			}
+		}()
+	}
+
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sort"
+	"unicode"
+)
+
+// categoryNames lists the general category buckets in report order. Every
+// processed character falls into exactly one of them, so they add up to the
+// total characters processed.
+var categoryNames = []string{
+	"letter",      // L
+	"digit",       // Nd
+	"number",      // Nl, No
+	"mark",        // M
+	"punctuation", // P
+	"symbol",      // S
+	"whitespace",  // Z and white space controls such as tab
+	"control",     // other Cc
+	"other",       // Cf, Co, Cs and unassigned code points
+	"unreadable",  // invalid UTF-8
+}
+
+// category returns the general category bucket of the valid character r
+func category(r rune) string {
+	switch {
+	case unicode.IsLetter(r):
+		return "letter"
+	case unicode.IsDigit(r):
+		return "digit"
+	case unicode.IsNumber(r):
+		return "number"
+	case unicode.IsMark(r):
+		return "mark"
+	case unicode.IsPunct(r):
+		return "punctuation"
+	case unicode.IsSymbol(r):
+		return "symbol"
+	case unicode.IsSpace(r):
+		return "whitespace"
+	case unicode.IsControl(r):
+		return "control"
+	default:
+		return "other"
+	}
+}
+
+// unknownScript is the script of characters in no unicode.Scripts table,
+// as in the Unicode Script property
+const unknownScript = "Unknown"
+
+// scriptNames lists the names of unicode.Scripts in a fixed order
+var scriptNames = func() []string {
+	names := make([]string, 0, len(unicode.Scripts))
+	for name := range unicode.Scripts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}()
+
+// scriptCache remembers the script of each character seen, as looking it up
+// means searching every script table
+type scriptCache map[rune]string
+
+// script returns the script of the valid character r, e.g. "Latin",
+// "Cyrillic", "Han", or "Common" for characters shared between scripts
+func (c scriptCache) script(r rune) string {
+	if name, ok := c[r]; ok {
+		return name
+	}
+
+	name := unknownScript
+	for _, candidate := range scriptNames {
+		if unicode.Is(unicode.Scripts[candidate], r) {
+			name = candidate
+			break
+		}
+	}
+	c[r] = name
+	return name
+}
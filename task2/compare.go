@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"unicode"
+)
+
+// thresholds are the limits of -compare. A limit is not checked when
+// maxChiSquared or maxDivergence is negative, or minCosine is 0.
+type thresholds struct {
+	maxChiSquared float64
+	minCosine     float64
+	maxDivergence float64
+}
+
+// charDelta compares the counts of one character in two files
+type charDelta struct {
+	char   rune
+	counts [2]int
+	freqs  [2]float64 // share of the characters of each file
+}
+
+// comparison compares the character distributions of two files
+type comparison struct {
+	names      [2]string
+	totals     [2]int      // characters counted in each file
+	chars      []charDelta // by decreasing difference in frequency
+	chiSquared float64     // of the 2 by K table of counts
+	degrees    int         // degrees of freedom of chiSquared
+	cosine     float64     // cosine similarity of the count vectors
+	divergence float64     // Jensen-Shannon divergence in bits, from 0 to 1
+	exceeded   []exceededLimit
+}
+
+// exceededLimit is a -compare threshold that a metric did not meet
+type exceededLimit struct {
+	metric string
+	value  float64
+	limit  float64
+}
+
+// compareCounts compares the distributions of every valid character of two
+// files, counted with countOptions.chars, and checks the metrics against
+// limits. Upper and lower case, whitespace and punctuation are told apart.
+func compareCounts(a, b fileResult, limits *thresholds) (*comparison, error) {
+	distributions := [2]map[rune]int{a.counts.chars, b.counts.chars}
+	c := &comparison{names: [2]string{a.name, b.name}}
+
+	chars := make(map[rune]bool)
+	for i, distribution := range distributions {
+		for char, count := range distribution {
+			chars[char] = true
+			c.totals[i] += count
+		}
+		if c.totals[i] == 0 {
+			return nil, fmt.Errorf("no characters to compare in %s", c.names[i])
+		}
+	}
+
+	var dot float64
+	var norms [2]float64
+	total := float64(c.totals[0] + c.totals[1])
+	for char := range chars {
+		delta := charDelta{char: char}
+		for i := range distributions {
+			delta.counts[i] = distributions[i][char]
+			delta.freqs[i] = float64(delta.counts[i]) / float64(c.totals[i])
+			norms[i] += float64(delta.counts[i]) * float64(delta.counts[i])
+		}
+		c.chars = append(c.chars, delta)
+		dot += float64(delta.counts[0]) * float64(delta.counts[1])
+
+		// Counts expected if both files shared one distribution
+		both := float64(delta.counts[0] + delta.counts[1])
+		for i := range distributions {
+			expected := float64(c.totals[i]) * both / total
+			diff := float64(delta.counts[i]) - expected
+			c.chiSquared += diff * diff / expected
+		}
+
+		// Jensen-Shannon divergence against the average of the frequencies
+		mean := (delta.freqs[0] + delta.freqs[1]) / 2
+		for i := range distributions {
+			if delta.freqs[i] > 0 {
+				c.divergence += delta.freqs[i] * math.Log2(delta.freqs[i]/mean) / 2
+			}
+		}
+	}
+	c.degrees = len(chars) - 1
+	c.cosine = dot / math.Sqrt(norms[0]*norms[1])
+
+	sort.Slice(c.chars, func(i, j int) bool {
+		di := math.Abs(c.chars[i].freqs[1] - c.chars[i].freqs[0])
+		dj := math.Abs(c.chars[j].freqs[1] - c.chars[j].freqs[0])
+		if di != dj {
+			return di > dj
+		}
+		return c.chars[i].char < c.chars[j].char
+	})
+
+	if limits.maxChiSquared >= 0 && c.chiSquared > limits.maxChiSquared {
+		c.exceeded = append(c.exceeded, exceededLimit{"chi-squared", c.chiSquared, limits.maxChiSquared})
+	}
+	if limits.minCosine > 0 && c.cosine < limits.minCosine {
+		c.exceeded = append(c.exceeded, exceededLimit{"cosine-similarity", c.cosine, limits.minCosine})
+	}
+	if limits.maxDivergence >= 0 && c.divergence > limits.maxDivergence {
+		c.exceeded = append(c.exceeded, exceededLimit{"js-divergence", c.divergence, limits.maxDivergence})
+	}
+
+	return c, nil
+}
+
+// compareWriters holds the writer of a comparison for each -format
+var compareWriters = map[string]func(w io.Writer, c *comparison) error{
+	"text": writeComparisonText,
+	"json": writeComparisonJSON,
+	"csv":  writeComparisonCSV,
+}
+
+// writeComparisonText writes a table of the characters followed by the
+// distance metrics and any thresholds exceeded
+func writeComparisonText(w io.Writer, c *comparison) error {
+	p := &printer{w: w}
+
+	p.printf("\n=== Character Comparison: %s vs %s ===\n", c.names[0], c.names[1])
+	p.println("All valid characters, case-sensitive")
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	tp := &printer{w: table}
+	tp.printf("char\tcount A\tcount B\tdelta\tfreq A\tfreq B\tfreq delta\t\n")
+	for _, d := range c.chars {
+		tp.printf("%s\t%d\t%d\t%+d\t%.2f%%\t%.2f%%\t%+.2f%%\t\n", charLabel(d.char), d.counts[0], d.counts[1],
+			d.counts[1]-d.counts[0], d.freqs[0]*100, d.freqs[1]*100, (d.freqs[1]-d.freqs[0])*100)
+	}
+	if tp.err != nil {
+		return tp.err
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+
+	p.println("\n=== Distance Metrics ===")
+	p.printf("Characters compared: %d in A, %d in B\n", c.totals[0], c.totals[1])
+	p.printf("Chi-squared: %.4f (%d degrees of freedom)\n", c.chiSquared, c.degrees)
+	p.printf("Cosine similarity: %.6f\n", c.cosine)
+	p.printf("Jensen-Shannon divergence: %.6f bits\n", c.divergence)
+	for _, e := range c.exceeded {
+		p.printf("Threshold exceeded: %s is %.6f, limit %g\n", e.metric, e.value, e.limit)
+	}
+
+	return p.err
+}
+
+// charLabel shows a character in the comparison table, quoting spaces and
+// control characters, e.g. ' ' or '\n'
+func charLabel(r rune) string {
+	if unicode.IsGraphic(r) && r != ' ' {
+		return string(r)
+	}
+	return strconv.QuoteRune(r)
+}
+
+// comparisonJSON is the JSON form of a comparison
+type comparisonJSON struct {
+	Files            [2]string           `json:"files"`
+	Totals           [2]int              `json:"totals"`
+	Characters       []charDeltaJSON     `json:"characters"`
+	ChiSquared       float64             `json:"chiSquared"`
+	DegreesOfFreedom int                 `json:"degreesOfFreedom"`
+	Cosine           float64             `json:"cosineSimilarity"`
+	Divergence       float64             `json:"jsDivergence"`
+	Exceeded         []exceededLimitJSON `json:"exceeded"`
+}
+
+// charDeltaJSON is the JSON form of the comparison of one character
+type charDeltaJSON struct {
+	Char        string     `json:"char"`
+	Counts      [2]int     `json:"counts"`
+	Delta       int        `json:"delta"`
+	Frequencies [2]float64 `json:"frequencies"`
+	FreqDelta   float64    `json:"frequencyDelta"`
+}
+
+// exceededLimitJSON is the JSON form of an exceeded threshold
+type exceededLimitJSON struct {
+	Metric string  `json:"metric"`
+	Value  float64 `json:"value"`
+	Limit  float64 `json:"limit"`
+}
+
+func writeComparisonJSON(w io.Writer, c *comparison) error {
+	report := comparisonJSON{
+		Files:            c.names,
+		Totals:           c.totals,
+		Characters:       make([]charDeltaJSON, 0, len(c.chars)),
+		ChiSquared:       c.chiSquared,
+		DegreesOfFreedom: c.degrees,
+		Cosine:           c.cosine,
+		Divergence:       c.divergence,
+		Exceeded:         make([]exceededLimitJSON, 0, len(c.exceeded)),
+	}
+	for _, d := range c.chars {
+		report.Characters = append(report.Characters, charDeltaJSON{
+			Char:        string(d.char),
+			Counts:      d.counts,
+			Delta:       d.counts[1] - d.counts[0],
+			Frequencies: d.freqs,
+			FreqDelta:   d.freqs[1] - d.freqs[0],
+		})
+	}
+	for _, e := range c.exceeded {
+		report.Exceeded = append(report.Exceeded, exceededLimitJSON{Metric: e.metric, Value: e.value, Limit: e.limit})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeComparisonCSV writes "kind,name,a,b,delta" rows: a count and a
+// frequency row per character, a metric row per distance metric with its
+// value as delta, and an exceeded row per threshold with the value as a and
+// the limit as b
+func writeComparisonCSV(w io.Writer, c *comparison) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"kind", "name", "a", "b", "delta"})
+
+	float := func(f float64) string {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+
+	for _, d := range c.chars {
+		writer.Write([]string{"count", string(d.char), strconv.Itoa(d.counts[0]), strconv.Itoa(d.counts[1]), strconv.Itoa(d.counts[1] - d.counts[0])})
+		writer.Write([]string{"frequency", string(d.char), float(d.freqs[0]), float(d.freqs[1]), float(d.freqs[1] - d.freqs[0])})
+	}
+	writer.Write([]string{"metric", "chi-squared", "", "", float(c.chiSquared)})
+	writer.Write([]string{"metric", "cosine-similarity", "", "", float(c.cosine)})
+	writer.Write([]string{"metric", "js-divergence", "", "", float(c.divergence)})
+	for _, e := range c.exceeded {
+		writer.Write([]string{"exceeded", e.metric, float(e.value), float(e.limit), ""})
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
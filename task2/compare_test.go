@@ -0,0 +1,129 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+func TestCompareCounts(t *testing.T) {
+	noLimits := thresholds{maxChiSquared: -1, maxDivergence: -1}
+
+	// The metrics of each case are worked out by hand. For a = {a: 2, b: 2}
+	// and b = {a: 3, b: 1}, every character is expected half in each file:
+	// chi-squared is 2*0.5²/2.5 + 2*0.5²/1.5 = 8/15, cosine 8/√(8*10), and
+	// the divergence against the mean frequencies (0.625, 0.375) is
+	// (0.5 log2 0.8 + 0.5 log2 4/3 + 0.75 log2 1.2 + 0.25 log2 2/3) / 2.
+	tests := []struct {
+		name       string
+		a, b       map[rune]int
+		limits     thresholds
+		chiSquared float64
+		degrees    int
+		cosine     float64
+		divergence float64
+		exceeded   []string
+	}{
+		{
+			name:       "identical",
+			a:          map[rune]int{'a': 2, 'b': 1},
+			b:          map[rune]int{'a': 2, 'b': 1},
+			limits:     noLimits,
+			chiSquared: 0,
+			degrees:    1,
+			cosine:     1,
+			divergence: 0,
+		},
+		{
+			name:       "same shape at another scale",
+			a:          map[rune]int{'a': 2, 'b': 1},
+			b:          map[rune]int{'a': 20, 'b': 10},
+			limits:     noLimits,
+			chiSquared: 0,
+			degrees:    1,
+			cosine:     1,
+			divergence: 0,
+		},
+		{
+			name:       "different",
+			a:          map[rune]int{'a': 2, 'b': 2},
+			b:          map[rune]int{'a': 3, 'b': 1},
+			limits:     noLimits,
+			chiSquared: 8.0 / 15,
+			degrees:    1,
+			cosine:     2 / math.Sqrt(5),
+			divergence: 0.0487948,
+		},
+		{
+			name:       "disjoint",
+			a:          map[rune]int{'x': 1},
+			b:          map[rune]int{'X': 1},
+			limits:     noLimits,
+			chiSquared: 2,
+			degrees:    1,
+			cosine:     0,
+			divergence: 1,
+		},
+		{
+			name:       "within limits",
+			a:          map[rune]int{'a': 2, 'b': 2},
+			b:          map[rune]int{'a': 3, 'b': 1},
+			limits:     thresholds{maxChiSquared: 1, minCosine: 0.8, maxDivergence: 0.1},
+			chiSquared: 8.0 / 15,
+			degrees:    1,
+			cosine:     2 / math.Sqrt(5),
+			divergence: 0.0487948,
+		},
+		{
+			name:       "limits exceeded",
+			a:          map[rune]int{'a': 2, 'b': 2},
+			b:          map[rune]int{'a': 3, 'b': 1},
+			limits:     thresholds{maxChiSquared: 0.5, minCosine: 0.9, maxDivergence: 0.04},
+			chiSquared: 8.0 / 15,
+			degrees:    1,
+			cosine:     2 / math.Sqrt(5),
+			divergence: 0.0487948,
+			exceeded:   []string{"chi-squared", "cosine-similarity", "js-divergence"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := fileResult{name: "a.txt", counts: &charCounts{chars: tt.a}}
+			b := fileResult{name: "b.txt", counts: &charCounts{chars: tt.b}}
+			c, err := compareCounts(a, b, &tt.limits)
+			if err != nil {
+				t.Fatalf("compareCounts: %v", err)
+			}
+
+			near := func(got, want float64) bool {
+				return math.Abs(got-want) < 1e-6
+			}
+			if !near(c.chiSquared, tt.chiSquared) || c.degrees != tt.degrees {
+				t.Errorf("chi-squared = %g with %d degrees, want %g with %d", c.chiSquared, c.degrees, tt.chiSquared, tt.degrees)
+			}
+			if !near(c.cosine, tt.cosine) {
+				t.Errorf("cosine = %g, want %g", c.cosine, tt.cosine)
+			}
+			if !near(c.divergence, tt.divergence) {
+				t.Errorf("divergence = %g, want %g", c.divergence, tt.divergence)
+			}
+
+			var exceeded []string
+			for _, limit := range c.exceeded {
+				exceeded = append(exceeded, limit.metric)
+			}
+			if !slices.Equal(exceeded, tt.exceeded) {
+				t.Errorf("exceeded = %v, want %v", exceeded, tt.exceeded)
+			}
+		})
+	}
+}
+
+func TestCompareCountsEmpty(t *testing.T) {
+	a := fileResult{name: "a.txt", counts: &charCounts{chars: map[rune]int{'a': 1}}}
+	b := fileResult{name: "b.txt", counts: &charCounts{chars: map[rune]int{}}}
+	if _, err := compareCounts(a, b, &thresholds{}); err == nil {
+		t.Error("compareCounts with an empty file succeeded, want an error")
+	}
+}
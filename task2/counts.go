@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"unicode"
+)
+
+// charCounts holds the characters counted in one or more files
+type charCounts struct {
+	letters        map[rune]int
+	numbers        map[rune]int
+	chars          map[rune]int // every valid character as read, nil unless counted
+	unreadable     int
+	totalProcessed int
+	invalid        []invalidSequence // the first keepInvalid sequences
+	invalidCount   int               // invalid sequences found, kept or not
+	keepInvalid    int
+	pending        invalidSequence // sequence being read, if pendingValid
+	pendingValid   bool
+	categories     map[string]int // characters per general category bucket
+	scripts        map[string]int // valid characters per script
+	scriptCache    scriptCache
+	words          *wordCounts  // nil unless words are analysed
+	encoding       string       // encoding the file was decoded from, empty for a total
+	encodingSource string       // how the encoding was chosen: sourceFlag, sourceBOM, sourceDetected or sourceDefault
+	repair         *repairStats // changes made by repairFile, or nil
+	warnings       *fileWarnings
+}
+
+// countOptions configures what is counted
+type countOptions struct {
+	words       *wordOptions // analyse words, or nil
+	chars       bool         // count every character as read, for -compare
+	encoding    *encoding    // encoding of the input, nil to detect it
+	noDetect    bool         // without encoding or a byte order mark, read UTF-8 rather than guess
+	keepInvalid int          // invalid sequences kept for the report, 0 for none
+	warnings    *warningLog  // receives warnings as they are found, or nil
+}
+
+func newCharCounts() *charCounts {
+	return &charCounts{
+		letters:     make(map[rune]int),
+		numbers:     make(map[rune]int),
+		categories:  make(map[string]int),
+		scripts:     make(map[string]int),
+		scriptCache: make(scriptCache),
+	}
+}
+
+// maxSequenceBytes is how many bytes of an invalid sequence are kept
+const maxSequenceBytes = 16
+
+// invalidSequence is a run of adjacent bytes on one line that are not valid
+// in the input encoding. Each invalid byte, or pair of bytes in UTF-16,
+// counts as one unreadable character.
+type invalidSequence struct {
+	line   int    // 1-based line number
+	column int    // 1-based column, counted in characters
+	offset int64  // byte offset from the start of the file
+	length int    // length in bytes
+	bytes  []byte // the first maxSequenceBytes bytes
+}
+
+// String describes the sequence for a warning, e.g.
+// "e4 b8 at line 3, column 7 (byte offset 52)"
+func (s invalidSequence) String() string {
+	text := fmt.Sprintf("% x", s.bytes)
+	if s.length > len(s.bytes) {
+		text += fmt.Sprintf(" ... (%d bytes)", s.length)
+	}
+	return fmt.Sprintf("%s at line %d, column %d (byte offset %d)", text, s.line, s.column, s.offset)
+}
+
+// countFile counts the characters of the named file
+func countFile(filename string, opts *countOptions) (*charCounts, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	return countReader(file, filename, opts, nil), nil
+}
+
+// maxReadErrors is how many read errors in a row countReader tolerates
+// before it gives up on the rest of the input
+const maxReadErrors = 3
+
+// countReader counts alphabet characters, numbers and unreadable characters
+// in r, the contents of the named file. The input is decoded as a stream in
+// the encoding of opts, or the one detected, so lines may be of any length
+// and line breaks are counted like other characters. A byte order mark is
+// not counted. Problems are logged as warnings as they are found rather than
+// stopping the count. Every character is also passed to repair, unless it
+// is nil.
+func countReader(r io.Reader, name string, opts *countOptions, repair *repairer) *charCounts {
+	counts := newCharCounts()
+	counts.keepInvalid = opts.keepInvalid
+	counts.warnings = opts.warnings.forFile(name)
+	if opts.words != nil {
+		counts.words = newWordCounts(opts.words)
+	}
+	if opts.chars {
+		counts.chars = make(map[rune]int)
+	}
+	reader := bufio.NewReader(r)
+
+	enc, source, bomSize := selectEncoding(r, reader, opts.encoding, !opts.noDetect)
+	counts.encoding, counts.encodingSource = enc.name, source
+	if source == sourceDetected && enc != utf8Encoding {
+		counts.warn("Warning: Reading as %s rather than UTF-8, as detected from the content; use -encoding utf-8 to read it as UTF-8", enc.name)
+	}
+	reader.Discard(bomSize)
+	decoder := enc.newDecoder(reader)
+
+	line, column := 1, 0
+	offset := int64(bomSize)
+	readErrors := 0 // failed reads in a row
+
+	for {
+		r, size, invalid, err := decoder.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Retry after a failed read, unless the input keeps failing
+			counts.endInvalid()
+			readErrors++
+			if readErrors == maxReadErrors {
+				counts.warn("Warning: Error reading file at byte offset %d: %v, giving up after %d errors in a row; counts cover only the data read so far", offset, err, maxReadErrors)
+				break
+			}
+			counts.warn("Warning: Error reading file at byte offset %d: %v, retrying...", offset, err)
+			continue
+		}
+		readErrors = 0
+
+		counts.totalProcessed++
+		column++
+
+		if invalid != nil {
+			counts.unreadable++
+			counts.categories["unreadable"]++
+			counts.addInvalid(line, column, offset, invalid)
+			counts.words.endWord()
+			repair.invalidBytes(invalid)
+		} else {
+			counts.endInvalid()
+			counts.addRune(r)
+			counts.words.feed(r)
+			repair.char(r)
+		}
+
+		offset += int64(size)
+		if r == '\n' {
+			line++
+			column = 0
+		}
+	}
+
+	counts.endInvalid()
+	counts.words.endWord()
+	repair.flush()
+	counts.warnings.finish()
+
+	return counts
+}
+
+// addRune counts the valid character r
+func (c *charCounts) addRune(r rune) {
+	category := category(r)
+	c.categories[category]++
+	c.scripts[c.scriptCache.script(r)]++
+	if c.chars != nil {
+		c.chars[r]++
+	}
+
+	switch category {
+	case "letter":
+		c.letters[unicode.ToLower(r)]++
+	case "digit":
+		c.numbers[r]++
+	}
+}
+
+// addInvalid records the invalid bytes at offset, extending the pending
+// sequence if it ends right before them
+func (c *charCounts) addInvalid(line, column int, offset int64, invalid []byte) {
+	s := &c.pending
+	if !c.pendingValid || s.line != line || s.offset+int64(s.length) != offset {
+		c.endInvalid()
+		*s = invalidSequence{line: line, column: column, offset: offset}
+		c.pendingValid = true
+	}
+
+	s.length += len(invalid)
+	if room := maxSequenceBytes - len(s.bytes); room > 0 {
+		s.bytes = append(s.bytes, invalid[:min(room, len(invalid))]...)
+	}
+}
+
+// endInvalid reports the pending invalid sequence, if any, and keeps it if
+// fewer than keepInvalid have been kept
+func (c *charCounts) endInvalid() {
+	if !c.pendingValid {
+		return
+	}
+
+	c.pendingValid = false
+	c.invalidCount++
+	c.warn("Warning: Found unreadable bytes %v, continuing...", c.pending)
+	if len(c.invalid) < c.keepInvalid {
+		c.invalid = append(c.invalid, c.pending)
+	}
+}
+
+// warn logs a warning about the counted input
+func (c *charCounts) warn(format string, args ...any) {
+	c.warnings.warn(format, args...)
+}
+
+// add adds the counts of other to c. Invalid sequences stay with their
+// file.
+func (c *charCounts) add(other *charCounts) {
+	for char, count := range other.letters {
+		c.letters[char] += count
+	}
+	for num, count := range other.numbers {
+		c.numbers[num] += count
+	}
+	for category, count := range other.categories {
+		c.categories[category] += count
+	}
+	for script, count := range other.scripts {
+		c.scripts[script] += count
+	}
+	if other.words != nil {
+		if c.words == nil {
+			c.words = newWordCounts(other.words.opts)
+		}
+		c.words.add(other.words)
+	}
+	c.unreadable += other.unreadable
+	c.totalProcessed += other.totalProcessed
+}
+
+func getTotalCount(charCount map[rune]int) int {
+	total := 0
+	for _, count := range charCount {
+		total += count
+	}
+	return total
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCountReader(t *testing.T) {
+	// The first read fills the 4096 byte buffer, so the é straddles the end
+	// of it
+	long := strings.Repeat("a", 4095) + "é1\n"
+
+	tests := []struct {
+		name       string
+		input      string
+		wrap       func(r io.Reader) io.Reader
+		letters    map[rune]int
+		numbers    map[rune]int
+		unreadable int
+		total      int
+		invalid    []invalidSequence
+		warnings   string
+	}{
+		{
+			name:    "one byte per read",
+			input:   "Aé😀2\n€ß",
+			wrap:    iotest.OneByteReader,
+			letters: map[rune]int{'a': 1, 'é': 1, 'ß': 1},
+			numbers: map[rune]int{'2': 1},
+			total:   7,
+		},
+		{
+			name:       "invalid bytes",
+			input:      "ab\xff\xfe\ncd\xe9é",
+			wrap:       iotest.OneByteReader,
+			letters:    map[rune]int{'a': 1, 'b': 1, 'c': 1, 'd': 1, 'é': 1},
+			numbers:    map[rune]int{},
+			unreadable: 3,
+			total:      9,
+			invalid: []invalidSequence{
+				{line: 1, column: 3, offset: 2, length: 2, bytes: []byte{0xff, 0xfe}},
+				{line: 2, column: 3, offset: 7, length: 1, bytes: []byte{0xe9}},
+			},
+			warnings: "Warning: Found unreadable bytes ff fe at line 1, column 3 (byte offset 2), continuing...\n" +
+				"Warning: Found unreadable bytes e9 at line 2, column 3 (byte offset 7), continuing...\n",
+		},
+		{
+			name:     "read error in a split character",
+			input:    long,
+			wrap:     iotest.TimeoutReader,
+			letters:  map[rune]int{'a': 4095, 'é': 1},
+			numbers:  map[rune]int{'1': 1},
+			total:    4098,
+			warnings: "Warning: Error reading file at byte offset 4095: timeout, retrying...\n",
+		},
+		{
+			name:  "read errors in a row",
+			input: "ab",
+			wrap: func(r io.Reader) io.Reader {
+				return io.MultiReader(r, iotest.ErrReader(errors.New("disk failure")))
+			},
+			letters: map[rune]int{'a': 1, 'b': 1},
+			numbers: map[rune]int{},
+			total:   2,
+			warnings: "Warning: Error reading file at byte offset 2: disk failure, retrying...\n" +
+				"Warning: Error reading file at byte offset 2: disk failure, retrying...\n" +
+				"Warning: Error reading file at byte offset 2: disk failure, giving up after 3 errors in a row; counts cover only the data read so far\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warnings strings.Builder
+			opts := &countOptions{
+				encoding:    utf8Encoding,
+				keepInvalid: 10,
+				warnings:    &warningLog{out: &warnings, max: -1},
+			}
+			counts := countReader(tt.wrap(strings.NewReader(tt.input)), "test.txt", opts, nil)
+
+			if !maps.Equal(counts.letters, tt.letters) {
+				t.Errorf("letters = %v, want %v", counts.letters, tt.letters)
+			}
+			if !maps.Equal(counts.numbers, tt.numbers) {
+				t.Errorf("numbers = %v, want %v", counts.numbers, tt.numbers)
+			}
+			if counts.unreadable != tt.unreadable || counts.totalProcessed != tt.total {
+				t.Errorf("unreadable, total = %d, %d, want %d, %d", counts.unreadable, counts.totalProcessed, tt.unreadable, tt.total)
+			}
+			equal := func(a, b invalidSequence) bool {
+				return a.line == b.line && a.column == b.column && a.offset == b.offset &&
+					a.length == b.length && string(a.bytes) == string(b.bytes)
+			}
+			if !slices.EqualFunc(counts.invalid, tt.invalid, equal) {
+				t.Errorf("invalid = %v, want %v", counts.invalid, tt.invalid)
+			}
+			if warnings.String() != tt.warnings {
+				t.Errorf("warnings = %q, want %q", warnings.String(), tt.warnings)
+			}
+		})
+	}
+}
+
+func TestCountReaderKeepsInvalid(t *testing.T) {
+	// Invalid sequences beyond keepInvalid are counted but not kept, and
+	// only the first maxSequenceBytes bytes of a long one are kept
+	input := strings.Repeat("\xff", 40) + "\n\xfe\n\xfe\n\xfe\n"
+	opts := &countOptions{encoding: utf8Encoding, keepInvalid: 2}
+	counts := countReader(strings.NewReader(input), "test.txt", opts, nil)
+
+	if counts.invalidCount != 4 || len(counts.invalid) != 2 {
+		t.Fatalf("found %d invalid sequences and kept %d, want 4 and 2", counts.invalidCount, len(counts.invalid))
+	}
+	if first := counts.invalid[0]; first.length != 40 || len(first.bytes) != maxSequenceBytes {
+		t.Errorf("first sequence has length %d and kept %d bytes, want 40 and %d", first.length, len(first.bytes), maxSequenceBytes)
+	}
+}
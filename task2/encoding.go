@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decoder reads the characters of an input in one encoding
+type decoder interface {
+	// next returns the next character and the number of bytes it was
+	// decoded from. Bytes that do not form a character in the encoding are
+	// returned in invalid instead. io.EOF marks the end of the input; after
+	// other errors next may be called again to retry.
+	next() (r rune, size int, invalid []byte, err error)
+}
+
+// encoding is a character encoding that task2 can decode
+type encoding struct {
+	name       string
+	bom        []byte // byte order mark, skipped at the start of the input
+	newDecoder func(r *bufio.Reader) decoder
+}
+
+var (
+	utf8Encoding = &encoding{
+		name: "utf-8",
+		bom:  []byte{0xEF, 0xBB, 0xBF},
+		newDecoder: func(r *bufio.Reader) decoder {
+			return utf8Decoder{r}
+		},
+	}
+	utf16LEEncoding = &encoding{
+		name: "utf-16le",
+		bom:  []byte{0xFF, 0xFE},
+		newDecoder: func(r *bufio.Reader) decoder {
+			return utf16Decoder{r, binary.LittleEndian}
+		},
+	}
+	utf16BEEncoding = &encoding{
+		name: "utf-16be",
+		bom:  []byte{0xFE, 0xFF},
+		newDecoder: func(r *bufio.Reader) decoder {
+			return utf16Decoder{r, binary.BigEndian}
+		},
+	}
+	latin1Encoding = &encoding{
+		name: "latin-1",
+		newDecoder: func(r *bufio.Reader) decoder {
+			return singleByteDecoder{r, &latin1Table}
+		},
+	}
+	windows1252Encoding = &encoding{
+		name: "windows-1252",
+		newDecoder: func(r *bufio.Reader) decoder {
+			return singleByteDecoder{r, &windows1252Table}
+		},
+	}
+)
+
+// encodingNames maps the accepted -encoding names, without case, dashes or
+// underscores, to their encodings
+var encodingNames = map[string]*encoding{
+	"utf8":        utf8Encoding,
+	"utf16le":     utf16LEEncoding,
+	"utf16be":     utf16BEEncoding,
+	"latin1":      latin1Encoding,
+	"iso88591":    latin1Encoding,
+	"windows1252": windows1252Encoding,
+	"cp1252":      windows1252Encoding,
+}
+
+// parseEncoding returns the named encoding, or nil for "auto"
+func parseEncoding(name string) (*encoding, error) {
+	key := strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	if key == "auto" {
+		return nil, nil
+	}
+	enc, ok := encodingNames[key]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding %q (want auto, utf-8, utf-16le, utf-16be, latin-1 or windows-1252)", name)
+	}
+	return enc, nil
+}
+
+// How the encoding of an input was chosen
+const (
+	sourceFlag     = "flag"     // named with -encoding
+	sourceBOM      = "bom"      // from the byte order mark
+	sourceDetected = "detected" // guessed from the content
+	sourceDefault  = "default"  // UTF-8, as detection was turned off
+)
+
+// detectSampleSize is how much of the input is examined to guess its
+// encoding when it has no byte order mark
+const detectSampleSize = 4096
+
+// minLegacyInvalid is the share of invalid UTF-8 bytes, in percent of the
+// sample, above which text may be Windows-1252. Accented letters make up a
+// few percent of Western European text, while a UTF-8 file with a few
+// corrupt bytes has far fewer.
+const minLegacyInvalid = 2
+
+// A sample shorter than minLegacySample bytes, or with fewer than
+// minLegacyInvalidBytes invalid ones, is too little evidence for
+// Windows-1252: a corrupt byte in a short file must still be reported.
+const (
+	minLegacySample       = 256
+	minLegacyInvalidBytes = 8
+)
+
+// selectEncoding returns the encoding of input, which r reads from its
+// current position, how it was chosen, and the length of its byte order
+// mark. enc is used if it is not nil, otherwise the byte order mark decides.
+// Input without one is detected from its content, or read as UTF-8 when
+// detect is false.
+func selectEncoding(input io.Reader, r *bufio.Reader, enc *encoding, detect bool) (selected *encoding, source string, bomSize int) {
+	// Errors other than a short input are left to the decoder to report
+	sample, _ := r.Peek(detectSampleSize)
+
+	if enc != nil {
+		if enc.bom != nil && bytes.HasPrefix(sample, enc.bom) {
+			return enc, sourceFlag, len(enc.bom)
+		}
+		return enc, sourceFlag, 0
+	}
+
+	for _, candidate := range []*encoding{utf8Encoding, utf16LEEncoding, utf16BEEncoding} {
+		if bytes.HasPrefix(sample, candidate.bom) {
+			return candidate, sourceBOM, len(candidate.bom)
+		}
+	}
+
+	if !detect {
+		return utf8Encoding, sourceDefault, 0
+	}
+
+	// A multi-byte UTF-8 character past the sample rules out Windows-1252
+	detected := detectEncoding(sample)
+	if detected == windows1252Encoding && !isLegacy(input, r) {
+		detected = utf8Encoding
+	}
+	return detected, sourceDetected, 0
+}
+
+// detectEncoding guesses the encoding of sample, the start of an input
+// without a byte order mark. Text that is mostly ASCII has a zero byte in
+// every other position in UTF-16. Otherwise text is taken as UTF-8 unless
+// it is long enough, has enough invalid bytes to make up at least
+// minLegacyInvalid percent of it, and has no multi-byte UTF-8 characters at
+// all, which is typical of Windows-1252.
+func detectEncoding(sample []byte) *encoding {
+	var zeros [2]int
+	for i, b := range sample {
+		if b == 0 {
+			zeros[i%2]++
+		}
+	}
+	// A few characters are too little to tell a stray zero byte from UTF-16
+	if pairs := len(sample) / 2; pairs >= 4 {
+		switch {
+		case zeros[1]*3 > pairs && zeros[0]*10 < pairs:
+			return utf16LEEncoding
+		case zeros[0]*3 > pairs && zeros[1]*10 < pairs:
+			return utf16BEEncoding
+		}
+	}
+
+	multiByte, invalid := 0, 0
+	sampleSize := len(sample)
+	for len(sample) > 0 {
+		r, size := utf8.DecodeRune(sample)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			// A character cut off at the end of the sample is not invalid
+			if !utf8.FullRune(sample) {
+				sample = nil
+				continue
+			}
+			invalid++
+		case size > 1:
+			multiByte++
+		}
+		sample = sample[size:]
+	}
+	if multiByte == 0 && sampleSize >= minLegacySample && invalid >= minLegacyInvalidBytes &&
+		invalid*100 >= sampleSize*minLegacyInvalid {
+		return windows1252Encoding
+	}
+	return utf8Encoding
+}
+
+// isLegacy reports whether input, from the position r reads at, has no
+// valid multi-byte UTF-8 character. The input is read again through
+// io.ReaderAt, leaving r as it was; other inputs cannot be checked and are
+// not legacy.
+func isLegacy(input io.Reader, r *bufio.Reader) bool {
+	file, ok := input.(interface {
+		io.ReaderAt
+		io.Seeker
+	})
+	if !ok {
+		return false
+	}
+	pos, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false
+	}
+
+	rest := bufio.NewReader(io.NewSectionReader(file, pos-int64(r.Buffered()), math.MaxInt64))
+	for {
+		c, size, err := rest.ReadRune()
+		if err == io.EOF {
+			return true
+		}
+		if err != nil || size > 1 && c != utf8.RuneError {
+			return false
+		}
+	}
+}
+
+// utf8Decoder decodes UTF-8, returning each invalid byte on its own
+type utf8Decoder struct {
+	reader *bufio.Reader
+}
+
+func (d utf8Decoder) next() (rune, int, []byte, error) {
+	// ReadRune would take a character cut off by a failed read for invalid
+	// bytes, so the rest is read first and an error returned for the caller
+	// to retry
+	if buffered, _ := d.reader.Peek(d.reader.Buffered()); !utf8.FullRune(buffered) {
+		if _, err := d.reader.Peek(utf8.UTFMax); err != nil && err != io.EOF {
+			return 0, 0, nil, err
+		}
+	}
+
+	// ReadRune refills its buffer when a character is split across reads
+	r, size, err := d.reader.ReadRune()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if r == utf8.RuneError && size == 1 {
+		d.reader.UnreadRune()
+		b, _ := d.reader.ReadByte()
+		return 0, 1, []byte{b}, nil
+	}
+	return r, size, nil, nil
+}
+
+// utf16Decoder decodes UTF-16 in the given byte order. Unpaired surrogates
+// and a final odd byte are invalid.
+type utf16Decoder struct {
+	reader *bufio.Reader
+	order  binary.ByteOrder
+}
+
+func (d utf16Decoder) next() (rune, int, []byte, error) {
+	unit, err := d.reader.Peek(2)
+	if len(unit) < 2 {
+		if err == io.EOF && len(unit) == 1 {
+			b, _ := d.reader.ReadByte()
+			return 0, 1, []byte{b}, nil
+		}
+		return 0, 0, nil, err
+	}
+
+	r := rune(d.order.Uint16(unit))
+	if utf16.IsSurrogate(r) {
+		pair, err := d.reader.Peek(4)
+		if len(pair) < 4 && err != io.EOF {
+			return 0, 0, nil, err
+		}
+		if len(pair) == 4 {
+			if decoded := utf16.DecodeRune(r, rune(d.order.Uint16(pair[2:]))); decoded != utf8.RuneError {
+				d.reader.Discard(4)
+				return decoded, 4, nil, nil
+			}
+		}
+		invalid := []byte{unit[0], unit[1]}
+		d.reader.Discard(2)
+		return 0, 2, invalid, nil
+	}
+
+	d.reader.Discard(2)
+	return r, 2, nil, nil
+}
+
+// singleByteDecoder decodes a code page of one byte per character. Bytes
+// the code page leaves undefined map to -1 and are invalid.
+type singleByteDecoder struct {
+	reader *bufio.Reader
+	table  *[256]rune
+}
+
+func (d singleByteDecoder) next() (rune, int, []byte, error) {
+	b, err := d.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if r := d.table[b]; r >= 0 {
+		return r, 1, nil, nil
+	}
+	return 0, 1, []byte{b}, nil
+}
+
+// latin1Table maps ISO 8859-1 bytes to the code points of the same value
+var latin1Table = func() (table [256]rune) {
+	for i := range table {
+		table[i] = rune(i)
+	}
+	return table
+}()
+
+// windows1252Table is ISO 8859-1 with printable characters in place of most
+// of the C1 controls 0x80 to 0x9F
+var windows1252Table = func() (table [256]rune) {
+	table = latin1Table
+	copy(table[0x80:0xA0], []rune{
+		'€', -1, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', -1, 'Ž', -1,
+		-1, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', -1, 'ž', 'Ÿ',
+	})
+	return table
+}()
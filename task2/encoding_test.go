@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// decoded is one result of decoder.next
+type decoded struct {
+	r       rune
+	size    int
+	invalid string
+}
+
+// decodeAll decodes input with enc one byte per read, so that every
+// character is split across reads
+func decodeAll(t *testing.T, enc *encoding, input string) []decoded {
+	t.Helper()
+	d := enc.newDecoder(bufio.NewReader(iotest.OneByteReader(strings.NewReader(input))))
+	var result []decoded
+	for {
+		r, size, invalid, err := d.next()
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatalf("next: %v", err)
+		}
+		result = append(result, decoded{r, size, string(invalid)})
+	}
+}
+
+func TestDecoders(t *testing.T) {
+	tests := []struct {
+		name  string
+		enc   *encoding
+		input string
+		want  []decoded
+	}{
+		{
+			name:  "utf-8",
+			enc:   utf8Encoding,
+			input: "aé€😀",
+			want:  []decoded{{'a', 1, ""}, {'é', 2, ""}, {'€', 3, ""}, {'😀', 4, ""}},
+		},
+		{
+			name:  "utf-8 invalid bytes",
+			enc:   utf8Encoding,
+			input: "a\xffb\xe2\x82",
+			want:  []decoded{{'a', 1, ""}, {0, 1, "\xff"}, {'b', 1, ""}, {0, 1, "\xe2"}, {0, 1, "\x82"}},
+		},
+		{
+			name:  "utf-16le surrogate pair",
+			enc:   utf16LEEncoding,
+			input: "a\x00\x3d\xd8\x00\xde",
+			want:  []decoded{{'a', 2, ""}, {'😀', 4, ""}},
+		},
+		{
+			name:  "utf-16be surrogate pair",
+			enc:   utf16BEEncoding,
+			input: "\x00a\xd8\x3d\xde\x00",
+			want:  []decoded{{'a', 2, ""}, {'😀', 4, ""}},
+		},
+		{
+			name:  "utf-16le unpaired surrogates",
+			enc:   utf16LEEncoding,
+			input: "\x3d\xd8a\x00\x00\xde\x3d\xd8",
+			want:  []decoded{{0, 2, "\x3d\xd8"}, {'a', 2, ""}, {0, 2, "\x00\xde"}, {0, 2, "\x3d\xd8"}},
+		},
+		{
+			name:  "utf-16le odd trailing byte",
+			enc:   utf16LEEncoding,
+			input: "a\x00b",
+			want:  []decoded{{'a', 2, ""}, {0, 1, "b"}},
+		},
+		{
+			name:  "utf-16be high surrogate and odd trailing byte",
+			enc:   utf16BEEncoding,
+			input: "\xd8\x3d\xde",
+			want:  []decoded{{0, 2, "\xd8\x3d"}, {0, 1, "\xde"}},
+		},
+		{
+			name:  "windows-1252",
+			enc:   windows1252Encoding,
+			input: "\x80\x9f\xe9a",
+			want:  []decoded{{'€', 1, ""}, {'Ÿ', 1, ""}, {'é', 1, ""}, {'a', 1, ""}},
+		},
+		{
+			name:  "windows-1252 undefined bytes",
+			enc:   windows1252Encoding,
+			input: "\x81\x8d\x8f\x90\x9d",
+			want:  []decoded{{0, 1, "\x81"}, {0, 1, "\x8d"}, {0, 1, "\x8f"}, {0, 1, "\x90"}, {0, 1, "\x9d"}},
+		},
+		{
+			name:  "latin-1",
+			enc:   latin1Encoding,
+			input: "\x80\x81\xff",
+			want:  []decoded{{0x80, 1, ""}, {0x81, 1, ""}, {'ÿ', 1, ""}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := decodeAll(t, tt.enc, tt.input)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("decoded %q as %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+// encodeUTF16 encodes text as UTF-16 in the given byte order
+func encodeUTF16(text string, order binary.AppendByteOrder) string {
+	var result []byte
+	for _, unit := range utf16.Encode([]rune(text)) {
+		result = order.AppendUint16(result, unit)
+	}
+	return string(result)
+}
+
+func TestDetectEncoding(t *testing.T) {
+	legacy := strings.Repeat("caf\xe9 na\xefve\n", 40)
+
+	tests := []struct {
+		name   string
+		sample string
+		want   *encoding
+	}{
+		{"empty", "", utf8Encoding},
+		{"ascii", "hello world\n", utf8Encoding},
+		{"utf-8", "café naïve\n", utf8Encoding},
+		{"legacy", legacy, windows1252Encoding},
+		{"invalid and multi-byte", legacy + "café\n", utf8Encoding},
+		{"few invalid bytes", "x\xff\n" + strings.Repeat("a", 4000), utf8Encoding},
+		{"short ASCII file with one bad byte", "Hello World 123\nab\xffcd\n", utf8Encoding},
+		{"short legacy file", "caf\xe9 na\xefve\n", utf8Encoding},
+		{"too few invalid bytes", strings.Repeat("caf\xe9 naive\n", 7), utf8Encoding},
+		{"character cut off at the end", "abc\xe2\x82", utf8Encoding},
+		{"utf-16le", encodeUTF16("hello wörld\n", binary.LittleEndian), utf16LEEncoding},
+		{"utf-16be", encodeUTF16("hello wörld\n", binary.BigEndian), utf16BEEncoding},
+		{"short with a zero byte", "a\x00\n", utf8Encoding},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectEncoding([]byte(tt.sample)); got != tt.want {
+				t.Errorf("detectEncoding(%q) = %s, want %s", tt.sample, got.name, tt.want.name)
+			}
+		})
+	}
+}
+
+func TestSelectEncoding(t *testing.T) {
+	legacy := strings.Repeat("caf\xe9 na\xefve\n", 500)
+
+	tests := []struct {
+		name    string
+		input   string
+		enc     *encoding
+		stream  bool // read through a plain io.Reader rather than a file
+		noGuess bool // turn detection off
+		want    *encoding
+		source  string
+		bomSize int
+	}{
+		{
+			name:    "utf-8 bom",
+			input:   "\xef\xbb\xbfabc",
+			want:    utf8Encoding,
+			source:  sourceBOM,
+			bomSize: 3,
+		},
+		{
+			name:    "utf-16le bom",
+			input:   "\xff\xfea\x00",
+			want:    utf16LEEncoding,
+			source:  sourceBOM,
+			bomSize: 2,
+		},
+		{
+			name:    "utf-16be bom",
+			input:   "\xfe\xff\x00a",
+			want:    utf16BEEncoding,
+			source:  sourceBOM,
+			bomSize: 2,
+		},
+		{
+			name:    "flag with its bom",
+			input:   "\xff\xfea\x00",
+			enc:     utf16LEEncoding,
+			want:    utf16LEEncoding,
+			source:  sourceFlag,
+			bomSize: 2,
+		},
+		{
+			name:   "flag overrides bom",
+			input:  "\xef\xbb\xbfabc",
+			enc:    latin1Encoding,
+			want:   latin1Encoding,
+			source: sourceFlag,
+		},
+		{
+			name:   "legacy file",
+			input:  legacy,
+			want:   windows1252Encoding,
+			source: sourceDetected,
+		},
+		{
+			name:   "multi-byte character after the sample",
+			input:  legacy + "café\n",
+			want:   utf8Encoding,
+			source: sourceDetected,
+		},
+		{
+			name:    "legacy file without detection",
+			input:   legacy,
+			noGuess: true,
+			want:    utf8Encoding,
+			source:  sourceDefault,
+		},
+		{
+			name:    "bom without detection",
+			input:   "\xff\xfea\x00",
+			noGuess: true,
+			want:    utf16LEEncoding,
+			source:  sourceBOM,
+			bomSize: 2,
+		},
+		{
+			name:   "legacy stream cannot be checked",
+			input:  legacy,
+			stream: true,
+			want:   utf8Encoding,
+			source: sourceDetected,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var input io.Reader = strings.NewReader(tt.input)
+			if tt.stream {
+				input = io.MultiReader(input)
+			} else {
+				path := filepath.Join(t.TempDir(), "input.txt")
+				if err := os.WriteFile(path, []byte(tt.input), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				file, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				input = file
+			}
+
+			reader := bufio.NewReader(input)
+			got, source, bomSize := selectEncoding(input, reader, tt.enc, !tt.noGuess)
+			if got != tt.want || source != tt.source || bomSize != tt.bomSize {
+				t.Errorf("selectEncoding = %s, %s, %d, want %s, %s, %d", got.name, source, bomSize, tt.want.name, tt.source, tt.bomSize)
+			}
+
+			// The check of the whole file leaves the reader at the start
+			rest, err := io.ReadAll(reader)
+			if err != nil || !bytes.Equal(rest, []byte(tt.input)) {
+				t.Errorf("reader left %d bytes (%v), want all %d", len(rest), err, len(tt.input))
+			}
+		})
+	}
+}
@@ -2,114 +2,247 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"sort"
-	"unicode"
-	"unicode/utf8"
+	"runtime"
 )
 
+// maxKeptInvalid is how many invalid sequences per file a JSON report lists
+const maxKeptInvalid = 10000
+
 func main() {
-	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run main.go <filename>")
+	workers := flag.Int("workers", runtime.NumCPU(), "number of files counted in parallel")
+	var filter fileFilter
+	flag.Var(&filter.include, "include", "only count files found in directories or globs whose name matches this pattern, e.g. *.txt (repeatable)")
+	flag.Var(&filter.exclude, "exclude", "skip files and directories whose name matches this pattern (repeatable)")
+	format := flag.String("format", "text", "report format: text, json or csv")
+	output := flag.String("output", "", "write the report to this file instead of stdout")
+	maxWarnings := flag.Int("max-warnings", 20, "print at most this many warnings per file, negative for all")
+	warningsFile := flag.String("warnings-file", "", "also write every warning to this file")
+	encodingName := flag.String("encoding", "auto", "input encoding: auto, utf-8, utf-16le, utf-16be, latin-1 or windows-1252")
+	words := flag.Bool("words", false, "also count words, character bigrams and trigrams, and word n-grams")
+	ngram := flag.Int("ngram", 2, "words per word n-gram with -words")
+	top := flag.Int("top", 20, "report only the most frequent entries of each -words table, 0 for all")
+	stopWordsFile := flag.String("stop-words", "", "leave the words listed in this file, one per line, out of -words counts")
+	repairPath := flag.String("repair", "", "write a repaired UTF-8 copy of the single input file to this file")
+	var repairOpts repairOptions
+	flag.StringVar(&repairOpts.invalid, "invalid", "replace", "with -repair, what becomes of unreadable characters: replace (with U+FFFD), drop, or escape (as \\xNN)")
+	flag.BoolVar(&repairOpts.stripControls, "strip-controls", false, "with -repair, drop control characters other than tab and line breaks")
+	flag.StringVar(&repairOpts.lineEndings, "line-endings", "keep", "with -repair, write line endings as found or convert them: keep, lf or crlf")
+	compare := flag.Bool("compare", false, "compare the case-sensitive distributions of all characters of exactly two files")
+	var limits thresholds
+	flag.Float64Var(&limits.maxChiSquared, "max-chi2", -1, "with -compare, exit with status 2 if chi-squared is above this, negative for no limit")
+	flag.Float64Var(&limits.minCosine, "min-cosine", 0, "with -compare, exit with status 2 if the cosine similarity is below this, 0 for no limit")
+	flag.Float64Var(&limits.maxDivergence, "max-js", -1, "with -compare, exit with status 2 if the Jensen-Shannon divergence is above this, negative for no limit")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		usage()
+		os.Exit(1)
+	}
+	if *workers < 1 {
+		log.Fatalf("Invalid -workers %d: must be at least 1", *workers)
+	}
+	writeFormat, ok := reportWriters[*format]
+	if !ok {
+		log.Fatalf("Invalid -format %q: want text, json or csv", *format)
 	}
 
-	filename := os.Args[1]
-	
-	// Read the file
-	file, err := os.Open(filename)
+	enc, err := parseEncoding(*encodingName)
 	if err != nil {
-		log.Fatalf("Error opening file: %v", err)
-	}
-	defer file.Close()
-
-	// Count alphabet characters, numbers, and unreadable characters
-	charCount := make(map[rune]int)
-	numberCount := make(map[rune]int)
-	unreadableCount := 0
-	totalProcessed := 0
-	scanner := bufio.NewScanner(file)
-	
-	for scanner.Scan() {
-		line := scanner.Text()
-		
-		// Process each byte in the line to handle invalid UTF-8
-		for len(line) > 0 {
-			r, size := utf8.DecodeRuneInString(line)
-			totalProcessed++
-			
-			if r == utf8.RuneError && size == 1 {
-				// Invalid UTF-8 sequence
-				unreadableCount++
-				fmt.Printf("Warning: Found unreadable character at position %d, continuing...\n", totalProcessed)
-			} else if unicode.IsLetter(r) {
-				// Valid letter character
-				charCount[unicode.ToLower(r)]++
-			} else if unicode.IsDigit(r) {
-				// Valid number character
-				numberCount[r]++
+		log.Fatalf("Invalid -encoding: %v", err)
+	}
+	opts := countOptions{encoding: enc}
+	if *words {
+		if *ngram < 2 {
+			log.Fatalf("Invalid -ngram %d: must be at least 2", *ngram)
+		}
+		if *top < 0 {
+			log.Fatalf("Invalid -top %d: must not be negative", *top)
+		}
+		opts.words = &wordOptions{ngram: *ngram, top: *top}
+		if *stopWordsFile != "" {
+			stopWords, err := loadStopWords(*stopWordsFile)
+			if err != nil {
+				log.Fatal(err)
 			}
-			// Skip other valid characters (spaces, punctuation, etc.)
-			
-			line = line[size:]
+			opts.words.stopWords = stopWords
 		}
 	}
 
-	// Handle scanner errors but continue processing
-	if err := scanner.Err(); err != nil {
-		fmt.Printf("Warning: Error reading file: %v, but continuing with processed data...\n", err)
+	if *compare {
+		if flag.NArg() != 2 {
+			log.Fatalf("-compare needs exactly two files, got %d paths", flag.NArg())
+		}
+		if *repairPath != "" || *words {
+			log.Fatal("-compare cannot be combined with -repair or -words")
+		}
+		opts.chars = true
+		for _, path := range flag.Args() {
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				log.Fatalf("-compare needs two files, %s is a directory", path)
+			}
+		}
 	}
 
-	// Sort characters alphabetically for consistent output
-	var chars []rune
-	for char := range charCount {
-		chars = append(chars, char)
+	// Expand directories and glob patterns into the files to count. Compared
+	// files are taken as given, in order.
+	files := flag.Args()
+	if !*compare {
+		files, err = collectFiles(flag.Args(), &filter)
+		if err != nil {
+			log.Fatalf("Error finding files: %v", err)
+		}
 	}
-	sort.Slice(chars, func(i, j int) bool {
-		return chars[i] < chars[j]
-	})
-
-	// Sort numbers numerically for consistent output
-	var numbers []rune
-	for num := range numberCount {
-		numbers = append(numbers, num)
+	if len(files) == 0 {
+		log.Fatal("No files to count")
+	}
+	if *repairPath != "" {
+		if len(files) > 1 {
+			log.Fatalf("-repair needs a single input file, found %d", len(files))
+		}
+		if err := repairOpts.validate(); err != nil {
+			log.Fatalf("Invalid repair options: %v", err)
+		}
 	}
-	sort.Slice(numbers, func(i, j int) bool {
-		return numbers[i] < numbers[j]
-	})
 
-	// Print results
-	fmt.Println("\n=== Character Count Results ===")
-	if len(chars) > 0 {
-		for _, char := range chars {
-			fmt.Printf("%c = %d\n", char, charCount[char])
+	// Warnings are printed as they are found
+	warnings := &warningLog{out: os.Stderr, max: *maxWarnings, batch: len(files) > 1}
+	var warningsOut *os.File
+	var warningsBuf *bufio.Writer
+	if *warningsFile != "" {
+		warningsOut, err = os.Create(*warningsFile)
+		if err != nil {
+			log.Fatalf("Error creating warnings file: %v", err)
 		}
+		warningsBuf = bufio.NewWriter(warningsOut)
+		warnings.file = warningsBuf
+	}
+	opts.warnings = warnings
+	if *format == "json" {
+		opts.keepInvalid = maxKeptInvalid
+	}
+
+	var results []fileResult
+	if *repairPath != "" {
+		counts, err := repairFile(files[0], *repairPath, &opts, &repairOpts)
+		results = []fileResult{{name: files[0], counts: counts, err: err}}
 	} else {
-		fmt.Println("No alphabet characters found in the file.")
+		results = countFiles(files, *workers, &opts)
+	}
+	batch := len(results) > 1 && !*compare
+
+	// A single file is reported on its own, several files along with their
+	// aggregated total
+	var total *charCounts
+	if batch {
+		total = newCharCounts()
 	}
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			if !batch {
+				log.Fatalf("Error counting %s: %v", result.name, result.err)
+			}
+			fmt.Fprintf(os.Stderr, "Error counting %s: %v\n", result.name, result.err)
+			failed++
+			continue
+		}
 
-	fmt.Println("\n=== Number Count Results ===")
-	if len(numbers) > 0 {
-		for _, num := range numbers {
-			fmt.Printf("%c = %d\n", num, numberCount[num])
+		if batch {
+			total.add(result.counts)
 		}
-	} else {
-		fmt.Println("No numbers found in the file.")
-	}
-	
-	// Print summary
-	fmt.Printf("\n=== Summary ===\n")
-	fmt.Printf("Total alphabet characters: %d\n", getTotalCount(charCount))
-	fmt.Printf("Total numbers: %d\n", getTotalCount(numberCount))
-	fmt.Printf("Unreadable characters: %d\n", unreadableCount)
-	fmt.Printf("Total characters processed: %d\n", totalProcessed)
+	}
+	if warningsOut != nil {
+		if warnings.err == nil {
+			warnings.err = warningsBuf.Flush()
+		}
+		if err := warningsOut.Close(); warnings.err == nil {
+			warnings.err = err
+		}
+		if warnings.err != nil {
+			log.Fatalf("Error writing warnings file: %v", warnings.err)
+		}
+	}
+
+	if *compare {
+		c, err := compareCounts(results[0], results[1], &limits)
+		if err != nil {
+			log.Fatalf("Error comparing: %v", err)
+		}
+		err = writeReport(*output, func(w io.Writer) error {
+			return compareWriters[*format](w, c)
+		})
+		if err != nil {
+			log.Fatalf("Error writing report: %v", err)
+		}
+		if len(c.exceeded) > 0 {
+			os.Exit(2)
+		}
+		return
+	}
+
+	err = writeReport(*output, func(w io.Writer) error {
+		return writeFormat(w, results, total)
+	})
+	if err != nil {
+		log.Fatalf("Error writing report: %v", err)
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
 
-func getTotalCount(charCount map[rune]int) int {
-	total := 0
-	for _, count := range charCount {
-		total += count
+// writeReport writes a report with write to the named file, or to stdout
+// when the name is empty
+func writeReport(name string, write func(w io.Writer) error) error {
+	if name == "" {
+		w := bufio.NewWriter(os.Stdout)
+		if err := write(w); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	file, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	if err := write(w); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
 	}
-	return total
-}
\ No newline at end of file
+	return file.Close()
+}
+
+// usage prints the command line help
+func usage() {
+	fmt.Println("Usage: go run . [flags] <path>...")
+	fmt.Println("Paths may be files, directories (searched recursively) or glob patterns.")
+	fmt.Println("Example: go run . test.txt")
+	fmt.Println("Example: go run . -include '*.txt' -exclude .git docs/ notes/*.md")
+	fmt.Println("Example: go run . -format json -output counts.json test.txt")
+	fmt.Println("Example: go run . -words -top 10 -stop-words stop.txt test.txt")
+	fmt.Println("Example: go run . -encoding windows-1252 legacy.txt")
+	fmt.Println("Example: go run . -repair clean.txt -invalid escape -line-endings lf dirty.txt")
+	fmt.Println("Example: go run . -compare -max-js 0.05 original.txt ocr.txt")
+	fmt.Println("With -encoding auto, UTF-8 and UTF-16 byte order marks are recognised. Files")
+	fmt.Println("without one are read as UTF-8, unless their content is clearly UTF-16, or has")
+	fmt.Println("many invalid bytes and no valid multi-byte UTF-8 characters, which is read as")
+	fmt.Println("Windows-1252 with a warning. -repair never guesses: it reads such files as UTF-8.")
+	fmt.Println("Warnings and errors are written to stderr. The exit status is 1 on errors, and")
+	fmt.Println("2 when -compare finds a metric beyond its threshold.")
+	fmt.Println("\nFlags:")
+	flag.CommandLine.SetOutput(os.Stdout)
+	flag.PrintDefaults()
+}
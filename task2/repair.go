@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"unicode"
+	"unicode/utf8"
+)
+
+// repairOptions configures the repaired copy of a file
+type repairOptions struct {
+	invalid       string // what becomes of invalid bytes: "replace", "drop" or "escape"
+	stripControls bool   // drop control characters other than tab and line breaks
+	lineEndings   string // "keep", "lf" or "crlf"
+}
+
+// validate checks the modes of opts
+func (opts *repairOptions) validate() error {
+	switch opts.invalid {
+	case "replace", "drop", "escape":
+	default:
+		return fmt.Errorf("invalid mode %q (want replace, drop or escape)", opts.invalid)
+	}
+	switch opts.lineEndings {
+	case "keep", "lf", "crlf":
+	default:
+		return fmt.Errorf("line ending %q (want keep, lf or crlf)", opts.lineEndings)
+	}
+	return nil
+}
+
+// repairStats counts the changes made by a repair
+type repairStats struct {
+	output             string // file the repaired copy was written to
+	invalid            int    // unreadable characters replaced, dropped or escaped
+	controlsStripped   int
+	lineEndingsChanged int
+}
+
+// repairer writes a sanitized UTF-8 copy of the characters counted by
+// countReader, whatever their input encoding
+type repairer struct {
+	opts    *repairOptions
+	w       *bufio.Writer
+	stats   repairStats
+	pending bool  // a carriage return was read, which may start a CRLF
+	err     error // first write error
+}
+
+// char writes the valid character r
+func (rp *repairer) char(r rune) {
+	if rp == nil {
+		return
+	}
+
+	if rp.opts.lineEndings != "keep" {
+		switch {
+		case rp.pending && r == '\n':
+			rp.pending = false
+			rp.lineEnding("\r\n")
+			return
+		case r == '\r':
+			rp.flush()
+			rp.pending = true
+			return
+		case r == '\n':
+			rp.flush()
+			rp.lineEnding("\n")
+			return
+		}
+	}
+	rp.flush()
+
+	if rp.opts.stripControls && unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+		rp.stats.controlsStripped++
+		return
+	}
+	rp.write(string(r))
+}
+
+// invalidBytes writes the bytes of one unreadable character as configured
+func (rp *repairer) invalidBytes(invalid []byte) {
+	if rp == nil {
+		return
+	}
+
+	rp.flush()
+	rp.stats.invalid++
+	switch rp.opts.invalid {
+	case "replace":
+		rp.write(string(utf8.RuneError))
+	case "escape":
+		for _, b := range invalid {
+			rp.write(fmt.Sprintf("\\x%02X", b))
+		}
+	}
+}
+
+// lineEnding writes the configured line ending in place of the one read
+func (rp *repairer) lineEnding(read string) {
+	ending := "\n"
+	if rp.opts.lineEndings == "crlf" {
+		ending = "\r\n"
+	}
+	if read != ending {
+		rp.stats.lineEndingsChanged++
+	}
+	rp.write(ending)
+}
+
+// flush writes a pending carriage return that did not start a CRLF. Callers
+// must also call it at the end of the input.
+func (rp *repairer) flush() {
+	if rp != nil && rp.pending {
+		rp.pending = false
+		rp.lineEnding("\r")
+	}
+}
+
+func (rp *repairer) write(text string) {
+	if rp.err == nil {
+		_, rp.err = rp.w.WriteString(text)
+	}
+}
+
+// repairFile counts the characters of the named file as countFile does
+// while writing a repaired copy of it to output. The repair statistics are
+// kept in the counts. A partial copy is removed on error. The encoding is
+// never guessed from the content, as a wrong guess would transcode invalid
+// bytes rather than repair them: without -encoding or a byte order mark the
+// file is read as UTF-8.
+func repairFile(filename, output string, opts *countOptions, repairOpts *repairOptions) (*charCounts, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	// Creating the output would truncate the input before it is read
+	if inInfo, err := file.Stat(); err == nil {
+		if outInfo, err := os.Stat(output); err == nil && os.SameFile(inInfo, outInfo) {
+			return nil, errors.New("the repaired copy cannot replace the file itself")
+		}
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return nil, fmt.Errorf("error creating repaired copy: %w", err)
+	}
+
+	rp := &repairer{opts: repairOpts, w: bufio.NewWriter(out), stats: repairStats{output: output}}
+	countOpts := *opts
+	countOpts.noDetect = true
+	counts := countReader(file, filename, &countOpts, rp)
+
+	err = rp.err
+	if err == nil {
+		err = rp.w.Flush()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(output)
+		return nil, fmt.Errorf("error writing repaired copy: %w", err)
+	}
+
+	counts.repair = &rp.stats
+	return counts, nil
+}
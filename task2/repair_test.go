@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepairFile(t *testing.T) {
+	// Enough invalid bytes for detection to take the file for Windows-1252,
+	// which repair must not do
+	legacy := strings.Repeat("caf\xe9\n", 100)
+
+	tests := []struct {
+		name     string
+		input    string
+		opts     repairOptions
+		want     string
+		invalid  int
+		controls int
+		endings  int
+	}{
+		{
+			name:    "replace",
+			input:   "bad \xc0\xc1 here\n",
+			opts:    repairOptions{invalid: "replace", lineEndings: "keep"},
+			want:    "bad �� here\n",
+			invalid: 2,
+		},
+		{
+			name:    "escape",
+			input:   "bad \xc0\xc1 here\n",
+			opts:    repairOptions{invalid: "escape", lineEndings: "keep"},
+			want:    "bad \\xC0\\xC1 here\n",
+			invalid: 2,
+		},
+		{
+			name:    "drop",
+			input:   "bad \xc0\xc1 here\n",
+			opts:    repairOptions{invalid: "drop", lineEndings: "keep"},
+			want:    "bad  here\n",
+			invalid: 2,
+		},
+		{
+			name:    "legacy content is not transcoded",
+			input:   legacy,
+			opts:    repairOptions{invalid: "replace", lineEndings: "keep"},
+			want:    strings.Repeat("caf�\n", 100),
+			invalid: 100,
+		},
+		{
+			name:  "utf-16 byte order mark",
+			input: "\xff\xfea\x00\n\x00",
+			opts:  repairOptions{invalid: "replace", lineEndings: "keep"},
+			want:  "a\n",
+		},
+		{
+			name:  "keep line endings",
+			input: "a\r\nb\rc\n",
+			opts:  repairOptions{invalid: "replace", lineEndings: "keep"},
+			want:  "a\r\nb\rc\n",
+		},
+		{
+			name:    "line endings to lf",
+			input:   "a\r\nb\rc\nd\r\r\ne\r",
+			opts:    repairOptions{invalid: "replace", lineEndings: "lf"},
+			want:    "a\nb\nc\nd\n\ne\n",
+			endings: 5,
+		},
+		{
+			name:    "line endings to crlf",
+			input:   "a\r\nb\rc\nd\r\r\ne\r",
+			opts:    repairOptions{invalid: "replace", lineEndings: "crlf"},
+			want:    "a\r\nb\r\nc\r\nd\r\n\r\ne\r\n",
+			endings: 4,
+		},
+		{
+			name:    "carriage return before an invalid byte",
+			input:   "a\r\xffb",
+			opts:    repairOptions{invalid: "escape", lineEndings: "lf"},
+			want:    "a\n\\xFFb",
+			invalid: 1,
+			endings: 1,
+		},
+		{
+			name:     "strip controls",
+			input:    "a\x00b\tc\x1b[0m\r\n",
+			opts:     repairOptions{invalid: "replace", lineEndings: "keep", stripControls: true},
+			want:     "ab\tc[0m\r\n",
+			controls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "input.txt")
+			output := filepath.Join(dir, "output.txt")
+			if err := os.WriteFile(input, []byte(tt.input), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			counts, err := repairFile(input, output, &countOptions{}, &tt.opts)
+			if err != nil {
+				t.Fatalf("repairFile: %v", err)
+			}
+			got, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("repaired %q to %q, want %q", tt.input, got, tt.want)
+			}
+
+			stats := counts.repair
+			if stats.invalid != tt.invalid || stats.controlsStripped != tt.controls || stats.lineEndingsChanged != tt.endings {
+				t.Errorf("fixed %d invalid, %d controls and %d line endings, want %d, %d and %d",
+					stats.invalid, stats.controlsStripped, stats.lineEndingsChanged, tt.invalid, tt.controls, tt.endings)
+			}
+			if counts.unreadable != tt.invalid {
+				t.Errorf("unreadable = %d, want %d", counts.unreadable, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestRepairFileRefusesItself(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte("abc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := repairOptions{invalid: "replace", lineEndings: "keep"}
+	if _, err := repairFile(path, path, &countOptions{}, &opts); err == nil {
+		t.Fatal("repairFile over its own input succeeded, want an error")
+	}
+	if got, err := os.ReadFile(path); err != nil || string(got) != "abc\n" {
+		t.Errorf("input is now %q (%v), want it unchanged", got, err)
+	}
+}
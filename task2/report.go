@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// totalName labels the aggregated counts of several files in CSV output
+const totalName = "(total)"
+
+// reportWriter writes a report of the counted files in one output format.
+// total is nil when a single file was counted.
+type reportWriter func(w io.Writer, results []fileResult, total *charCounts) error
+
+// reportWriters holds the writer of each -format
+var reportWriters = map[string]reportWriter{
+	"text": writeText,
+	"json": writeJSON,
+	"csv":  writeCSV,
+}
+
+// writeText writes the counts of every file in the human-readable layout,
+// followed by the total when several files were counted
+func writeText(w io.Writer, results []fileResult, total *charCounts) error {
+	if total == nil {
+		return writeCounts(w, results[0].counts)
+	}
+
+	counted := 0
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "\n==> %s <==\n", result.name); err != nil {
+			return err
+		}
+		if err := writeCounts(w, result.counts); err != nil {
+			return err
+		}
+		counted++
+	}
+
+	if _, err := fmt.Fprintf(w, "\n==> total of %d files <==\n", counted); err != nil {
+		return err
+	}
+	return writeCounts(w, total)
+}
+
+// writeCounts writes the character and number counts followed by a summary
+func writeCounts(w io.Writer, counts *charCounts) error {
+	// Sort characters alphabetically and numbers numerically for consistent
+	// output
+	chars := sortedRunes(counts.letters)
+	numbers := sortedRunes(counts.numbers)
+
+	p := &printer{w: w}
+
+	p.println("\n=== Character Count Results ===")
+	if len(chars) > 0 {
+		for _, char := range chars {
+			p.printf("%c = %d\n", char, counts.letters[char])
+		}
+	} else {
+		p.println("No alphabet characters found in the file.")
+	}
+
+	p.println("\n=== Number Count Results ===")
+	if len(numbers) > 0 {
+		for _, num := range numbers {
+			p.printf("%c = %d\n", num, counts.numbers[num])
+		}
+	} else {
+		p.println("No numbers found in the file.")
+	}
+
+	p.printf("\n=== Summary ===\n")
+	p.printf("Total alphabet characters: %d\n", getTotalCount(counts.letters))
+	p.printf("Total numbers: %d\n", getTotalCount(counts.numbers))
+	p.printf("Unreadable characters: %d\n", counts.unreadable)
+	p.printf("Total characters processed: %d\n", counts.totalProcessed)
+	if counts.encoding != "" {
+		p.printf("Encoding: %s (%s)\n", counts.encoding, encodingSourceText[counts.encodingSource])
+	}
+
+	p.println("\n=== Category Results ===")
+	for _, category := range categoryNames {
+		p.printf("%s = %d\n", category, counts.categories[category])
+	}
+
+	p.println("\n=== Script Results ===")
+	for _, script := range sortedKeys(counts.scripts) {
+		p.printf("%s = %d\n", script, counts.scripts[script])
+	}
+
+	if repair := counts.repair; repair != nil {
+		p.println("\n=== Repair Results ===")
+		p.printf("Repaired copy: %s\n", repair.output)
+		p.printf("Unreadable characters fixed: %d\n", repair.invalid)
+		p.printf("Control characters stripped: %d\n", repair.controlsStripped)
+		p.printf("Line endings converted: %d\n", repair.lineEndingsChanged)
+	}
+
+	if words := counts.words; words != nil {
+		p.println("\n=== Word Summary ===")
+		p.printf("Total words: %d\n", words.total)
+		p.printf("Distinct words: %d\n", len(words.words))
+		p.printf("Stop words skipped: %d\n", words.stopped)
+
+		for _, table := range words.tables() {
+			p.printf("\n=== %s Results ===\n", table.title)
+			if len(table.entries) == 0 {
+				p.println("None found.")
+			}
+			for _, entry := range table.entries {
+				p.printf("%s = %d\n", entry.text, entry.count)
+			}
+		}
+	}
+
+	return p.err
+}
+
+// encodingSourceText describes how an encoding was chosen in text reports
+var encodingSourceText = map[string]string{
+	sourceFlag:     "from -encoding",
+	sourceBOM:      "from byte order mark",
+	sourceDetected: "detected",
+	sourceDefault:  "default",
+}
+
+// printer writes formatted text, keeping the first error
+type printer struct {
+	w   io.Writer
+	err error
+}
+
+func (p *printer) printf(format string, args ...any) {
+	if p.err == nil {
+		_, p.err = fmt.Fprintf(p.w, format, args...)
+	}
+}
+
+func (p *printer) println(text string) {
+	p.printf("%s\n", text)
+}
+
+// countsJSON is the JSON form of the counts of one file or of the total
+type countsJSON struct {
+	File             string         `json:"file,omitempty"`
+	Encoding         string         `json:"encoding,omitempty"`
+	EncodingSource   string         `json:"encodingSource,omitempty"` // flag, bom, detected or default
+	Letters          map[string]int `json:"letters"`
+	Digits           map[string]int `json:"digits"`
+	Unreadable       int            `json:"unreadable"`
+	TotalProcessed   int            `json:"totalProcessed"`
+	Categories       map[string]int `json:"categories"`
+	Scripts          map[string]int `json:"scripts"`
+	Words            *wordsJSON     `json:"words,omitempty"`
+	Repair           *repairJSON    `json:"repair,omitempty"`
+	InvalidSequences []invalidJSON  `json:"invalidSequences,omitempty"`
+	InvalidOmitted   int            `json:"invalidSequencesOmitted,omitempty"` // found beyond the ones listed
+}
+
+// invalidJSON is the JSON form of an invalid UTF-8 sequence
+type invalidJSON struct {
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int64  `json:"offset"`
+	Length int    `json:"length"`
+	Bytes  string `json:"bytes"` // hex of at most the first 16 bytes, e.g. "e4 b8"
+}
+
+// wordsJSON is the JSON form of the word analysis, with each table limited
+// to the top entries
+type wordsJSON struct {
+	Total            int         `json:"total"`
+	Distinct         int         `json:"distinct"`
+	StopWordsSkipped int         `json:"stopWordsSkipped"`
+	Words            []entryJSON `json:"words"`
+	CharBigrams      []entryJSON `json:"charBigrams"`
+	CharTrigrams     []entryJSON `json:"charTrigrams"`
+	NgramSize        int         `json:"ngramSize"`
+	WordNgrams       []entryJSON `json:"wordNgrams"`
+}
+
+// repairJSON is the JSON form of the changes made by -repair
+type repairJSON struct {
+	Output             string `json:"output"`
+	Invalid            int    `json:"invalid"`
+	ControlsStripped   int    `json:"controlsStripped"`
+	LineEndingsChanged int    `json:"lineEndingsChanged"`
+}
+
+// entryJSON is the JSON form of a frequency table entry
+type entryJSON struct {
+	Text  string `json:"text"`
+	Count int    `json:"count"`
+}
+
+// fileErrorJSON is the JSON form of a file that could not be counted
+type fileErrorJSON struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// batchJSON is the JSON report of several files
+type batchJSON struct {
+	Files []any      `json:"files"`
+	Total countsJSON `json:"total"`
+}
+
+// newCountsJSON converts counts to their JSON form
+func newCountsJSON(name string, counts *charCounts) countsJSON {
+	return countsJSON{
+		File:             name,
+		Encoding:         counts.encoding,
+		EncodingSource:   counts.encodingSource,
+		Letters:          stringKeys(counts.letters),
+		Digits:           stringKeys(counts.numbers),
+		Unreadable:       counts.unreadable,
+		TotalProcessed:   counts.totalProcessed,
+		Categories:       categoryCounts(counts),
+		Scripts:          counts.scripts,
+		Words:            newWordsJSON(counts.words),
+		Repair:           newRepairJSON(counts.repair),
+		InvalidSequences: invalidSequencesJSON(counts.invalid),
+		InvalidOmitted:   counts.invalidCount - len(counts.invalid),
+	}
+}
+
+// newRepairJSON converts repair statistics to their JSON form, or returns
+// nil if the file was not repaired
+func newRepairJSON(stats *repairStats) *repairJSON {
+	if stats == nil {
+		return nil
+	}
+	return &repairJSON{
+		Output:             stats.output,
+		Invalid:            stats.invalid,
+		ControlsStripped:   stats.controlsStripped,
+		LineEndingsChanged: stats.lineEndingsChanged,
+	}
+}
+
+// newWordsJSON converts the word analysis to its JSON form, or returns nil
+// if words were not analysed
+func newWordsJSON(words *wordCounts) *wordsJSON {
+	if words == nil {
+		return nil
+	}
+
+	entries := func(counts map[string]int) []entryJSON {
+		result := []entryJSON{}
+		for _, entry := range topCounts(counts, words.opts.top) {
+			result = append(result, entryJSON{Text: entry.text, Count: entry.count})
+		}
+		return result
+	}
+
+	return &wordsJSON{
+		Total:            words.total,
+		Distinct:         len(words.words),
+		StopWordsSkipped: words.stopped,
+		Words:            entries(words.words),
+		CharBigrams:      entries(words.bigrams),
+		CharTrigrams:     entries(words.trigrams),
+		NgramSize:        words.opts.ngram,
+		WordNgrams:       entries(words.ngrams),
+	}
+}
+
+// invalidSequencesJSON converts invalid sequences to their JSON form
+func invalidSequencesJSON(sequences []invalidSequence) []invalidJSON {
+	var result []invalidJSON
+	for _, s := range sequences {
+		result = append(result, invalidJSON{Line: s.line, Column: s.column, Offset: s.offset, Length: s.length, Bytes: fmt.Sprintf("% x", s.bytes)})
+	}
+	return result
+}
+
+// writeJSON writes the counts of a single file as one object, or of several
+// files as an object holding every file and the total
+func writeJSON(w io.Writer, results []fileResult, total *charCounts) error {
+	var report any
+	if total == nil {
+		report = newCountsJSON(results[0].name, results[0].counts)
+	} else {
+		batch := batchJSON{Files: make([]any, 0, len(results)), Total: newCountsJSON("", total)}
+		for _, result := range results {
+			if result.err != nil {
+				batch.Files = append(batch.Files, fileErrorJSON{File: result.name, Error: result.err.Error()})
+			} else {
+				batch.Files = append(batch.Files, newCountsJSON(result.name, result.counts))
+			}
+		}
+		report = batch
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// writeCSV writes one "file,kind,character,count" row per counted letter
+// and digit, followed by the unreadable and processed totals, the general
+// categories and the scripts of each file and, for several files, of the
+// total. Category and script rows hold their name in the character column,
+// as do the word, char-bigram, char-trigram and word-ngram rows of -words.
+// The encoding row of a file holds the encoding name and no count, and the
+// repair rows of -repair the name of the change.
+func writeCSV(w io.Writer, results []fileResult, total *charCounts) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"file", "kind", "character", "count"})
+
+	writeRows := func(name string, counts *charCounts) {
+		if counts.encoding != "" {
+			writer.Write([]string{name, "encoding", counts.encoding, ""})
+		}
+		for _, char := range sortedRunes(counts.letters) {
+			writer.Write([]string{name, "letter", string(char), strconv.Itoa(counts.letters[char])})
+		}
+		for _, num := range sortedRunes(counts.numbers) {
+			writer.Write([]string{name, "digit", string(num), strconv.Itoa(counts.numbers[num])})
+		}
+		writer.Write([]string{name, "unreadable", "", strconv.Itoa(counts.unreadable)})
+		writer.Write([]string{name, "processed", "", strconv.Itoa(counts.totalProcessed)})
+		for _, category := range categoryNames {
+			writer.Write([]string{name, "category", category, strconv.Itoa(counts.categories[category])})
+		}
+		for _, script := range sortedKeys(counts.scripts) {
+			writer.Write([]string{name, "script", script, strconv.Itoa(counts.scripts[script])})
+		}
+		if repair := counts.repair; repair != nil {
+			writer.Write([]string{name, "repair", "invalid", strconv.Itoa(repair.invalid)})
+			writer.Write([]string{name, "repair", "controls-stripped", strconv.Itoa(repair.controlsStripped)})
+			writer.Write([]string{name, "repair", "line-endings-changed", strconv.Itoa(repair.lineEndingsChanged)})
+		}
+		if counts.words != nil {
+			for _, table := range counts.words.tables() {
+				for _, entry := range table.entries {
+					writer.Write([]string{name, table.name, entry.text, strconv.Itoa(entry.count)})
+				}
+			}
+		}
+	}
+
+	for _, result := range results {
+		if result.err == nil {
+			writeRows(result.name, result.counts)
+		}
+	}
+	if total != nil {
+		writeRows(totalName, total)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// categoryCounts returns the count of every general category bucket,
+// including the empty ones
+func categoryCounts(counts *charCounts) map[string]int {
+	result := make(map[string]int, len(categoryNames))
+	for _, category := range categoryNames {
+		result[category] = counts.categories[category]
+	}
+	return result
+}
+
+// stringKeys converts a rune count map to one keyed by the characters
+func stringKeys(counts map[rune]int) map[string]int {
+	result := make(map[string]int, len(counts))
+	for r, count := range counts {
+		result[string(r)] = count
+	}
+	return result
+}
+
+// sortedKeys returns the keys of counts in ascending order
+func sortedKeys(counts map[string]int) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sortedRunes returns the keys of counts in ascending order
+func sortedRunes(counts map[rune]int) []rune {
+	runes := make([]rune, 0, len(counts))
+	for r := range counts {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		return runes[i] < runes[j]
+	})
+	return runes
+}
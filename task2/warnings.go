@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// warningLog prints warnings to stderr as files are counted, up to a limit
+// per file, and optionally all of them to a file. Warnings are prefixed with
+// the file name when several files are counted. It is safe for concurrent
+// use by the workers counting files.
+type warningLog struct {
+	out   io.Writer // usually os.Stderr
+	max   int       // warnings printed to out per file, negative for all
+	file  io.Writer // receives every warning, or nil
+	batch bool
+
+	mu  sync.Mutex
+	err error // first error writing to file
+}
+
+// forFile returns the warnings of the named file. A nil log discards them.
+func (l *warningLog) forFile(name string) *fileWarnings {
+	return &fileWarnings{log: l, name: name}
+}
+
+// write logs one warning of the named file; n is its number in that file
+func (l *warningLog) write(name string, n int, warning string) {
+	prefix := ""
+	if l.batch {
+		prefix = name + ": "
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max < 0 || n <= l.max {
+		fmt.Fprintf(l.out, "%s%s\n", prefix, warning)
+	}
+	if l.file != nil && l.err == nil {
+		_, l.err = fmt.Fprintf(l.file, "%s%s\n", prefix, warning)
+	}
+}
+
+// fileWarnings issues the warnings of one counted file
+type fileWarnings struct {
+	log   *warningLog
+	name  string
+	count int // warnings issued
+}
+
+// warn logs a warning. The message is only formatted if it is printed or
+// written to the warnings file, as a corrupt file can raise millions.
+func (w *fileWarnings) warn(format string, args ...any) {
+	if w == nil {
+		return
+	}
+
+	w.count++
+	if l := w.log; l != nil && (l.max < 0 || w.count <= l.max || l.file != nil) {
+		l.write(w.name, w.count, fmt.Sprintf(format, args...))
+	}
+}
+
+// finish notes how many warnings of the file were not printed
+func (w *fileWarnings) finish() {
+	if w == nil || w.log == nil {
+		return
+	}
+
+	l := w.log
+	if suppressed := w.count - l.max; l.max >= 0 && suppressed > 0 {
+		prefix := ""
+		if l.batch {
+			prefix = w.name + ": "
+		}
+		l.mu.Lock()
+		fmt.Fprintf(l.out, "%s%d more warnings not shown\n", prefix, suppressed)
+		l.mu.Unlock()
+	}
+}
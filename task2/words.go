@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// wordOptions configures the word analysis
+type wordOptions struct {
+	stopWords map[string]bool // lowercase words left out of word counts and n-grams, which do not span them
+	ngram     int             // words per word n-gram, at least 2
+	top       int             // entries reported per table, 0 for all
+}
+
+// wordCounts holds the word and n-gram frequencies of one or more files.
+// Words are read one character at a time with feed.
+type wordCounts struct {
+	opts     *wordOptions
+	total    int // words counted, not including stop words
+	stopped  int // stop words skipped
+	words    map[string]int
+	bigrams  map[string]int // character bigrams within words, not across separators
+	trigrams map[string]int // character trigrams within words, not across separators
+	ngrams   map[string]int // word n-grams, words joined by a space
+
+	current []rune   // lowercase characters of the word being read
+	mid     rune     // separator read after current that may continue the word
+	recent  []string // the last words counted, for word n-grams
+}
+
+func newWordCounts(opts *wordOptions) *wordCounts {
+	return &wordCounts{
+		opts:     opts,
+		words:    make(map[string]int),
+		bigrams:  make(map[string]int),
+		trigrams: make(map[string]int),
+		ngrams:   make(map[string]int),
+	}
+}
+
+// feed reads the next character. Words follow the Unicode word boundary
+// rules (UAX #29) for the common cases: a word is a run of letters, marks and
+// digits, which an apostrophe or period joins between letters ("don't",
+// "e.g") and a period or comma joins between digits ("3.14", "1,000").
+// Ideographs and hiragana are words of one character each.
+func (w *wordCounts) feed(r rune) {
+	if w == nil {
+		return
+	}
+
+	switch {
+	case unicode.In(r, unicode.Ideographic, unicode.Hiragana):
+		w.endWord()
+		w.current = append(w.current, r)
+		w.endWord()
+	case unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsDigit(r):
+		if w.mid != 0 {
+			if joins(w.current[len(w.current)-1], w.mid, r) {
+				w.current = append(w.current, w.mid)
+				w.mid = 0
+			} else {
+				w.endWord()
+			}
+		}
+		w.current = append(w.current, unicode.ToLower(r))
+	case len(w.current) > 0 && w.mid == 0 && strings.ContainsRune("'’.,", r):
+		w.mid = r
+	default:
+		w.endWord()
+	}
+}
+
+// joins reports whether the separator mid between the characters before and
+// after continues a word
+func joins(before, mid, after rune) bool {
+	if unicode.IsDigit(before) && unicode.IsDigit(after) {
+		return mid == '.' || mid == ','
+	}
+	return !unicode.IsDigit(before) && unicode.IsLetter(after) && mid != ','
+}
+
+// endWord counts the word being read, if any. Callers must also call it at
+// the end of the input.
+func (w *wordCounts) endWord() {
+	if w == nil {
+		return
+	}
+
+	w.mid = 0
+	if len(w.current) == 0 {
+		return
+	}
+
+	// Count the same apostrophe however it was typed
+	for i, r := range w.current {
+		if r == '’' {
+			w.current[i] = '\''
+		}
+	}
+
+	// Stop words are left out of the character n-grams too, and end the
+	// window of word n-grams so that none spans them
+	word := string(w.current)
+	if w.opts.stopWords[word] {
+		w.current = w.current[:0]
+		w.recent = w.recent[:0]
+		w.stopped++
+		return
+	}
+
+	segmentStart := 0
+	for i, r := range w.current {
+		if strings.ContainsRune("'.,", r) {
+			segmentStart = i + 1
+			continue
+		}
+		if i-segmentStart >= 1 {
+			w.bigrams[string(w.current[i-1:i+1])]++
+		}
+		if i-segmentStart >= 2 {
+			w.trigrams[string(w.current[i-2:i+1])]++
+		}
+	}
+	w.current = w.current[:0]
+
+	w.total++
+	w.words[word]++
+
+	w.recent = append(w.recent, word)
+	if len(w.recent) > w.opts.ngram {
+		w.recent = append(w.recent[:0], w.recent[1:]...)
+	}
+	if len(w.recent) == w.opts.ngram {
+		w.ngrams[strings.Join(w.recent, " ")]++
+	}
+}
+
+// add adds the frequencies of other to w. Word n-grams do not span files.
+func (w *wordCounts) add(other *wordCounts) {
+	w.total += other.total
+	w.stopped += other.stopped
+	for _, tables := range [][2]map[string]int{
+		{w.words, other.words},
+		{w.bigrams, other.bigrams},
+		{w.trigrams, other.trigrams},
+		{w.ngrams, other.ngrams},
+	} {
+		for key, count := range tables[1] {
+			tables[0][key] += count
+		}
+	}
+}
+
+// countEntry is one entry of a frequency table
+type countEntry struct {
+	text  string
+	count int
+}
+
+// topCounts returns the n most frequent entries of counts, or all of them
+// if n is 0. Entries with the same count are ordered by text.
+func topCounts(counts map[string]int, n int) []countEntry {
+	entries := make([]countEntry, 0, len(counts))
+	for text, count := range counts {
+		entries = append(entries, countEntry{text: text, count: count})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].count != entries[j].count {
+			return entries[i].count > entries[j].count
+		}
+		return entries[i].text < entries[j].text
+	})
+
+	if n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// wordTable is a frequency table of the word analysis, as reported
+type wordTable struct {
+	name    string // kind column of CSV rows
+	title   string // text section heading
+	entries []countEntry
+}
+
+// tables returns the frequency tables of w, limited to the top entries
+func (w *wordCounts) tables() []wordTable {
+	return []wordTable{
+		{"word", "Word", topCounts(w.words, w.opts.top)},
+		{"char-bigram", "Character Bigram", topCounts(w.bigrams, w.opts.top)},
+		{"char-trigram", "Character Trigram", topCounts(w.trigrams, w.opts.top)},
+		{"word-ngram", fmt.Sprintf("Word %d-gram", w.opts.ngram), topCounts(w.ngrams, w.opts.top)},
+	}
+}
+
+// loadStopWords reads a stop word list: one word per line, with blank lines
+// and lines starting with # ignored. Words are matched case-insensitively.
+func loadStopWords(filename string) (map[string]bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("error opening stop words: %w", err)
+	}
+	defer file.Close()
+
+	stopWords := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		word := strings.TrimSpace(scanner.Text())
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		stopWords[strings.ReplaceAll(strings.ToLower(word), "’", "'")] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stop words: %w", err)
+	}
+
+	return stopWords, nil
+}
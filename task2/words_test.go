@@ -0,0 +1,138 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestWordCounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		stopWords []string
+		ngram     int
+		words     map[string]int
+		bigrams   map[string]int
+		trigrams  map[string]int
+		ngrams    map[string]int
+		stopped   int
+	}{
+		{
+			name:     "apostrophe",
+			input:    "Don't",
+			words:    map[string]int{"don't": 1},
+			bigrams:  map[string]int{"do": 1, "on": 1},
+			trigrams: map[string]int{"don": 1},
+		},
+		{
+			name:    "typographic apostrophe",
+			input:   "it’s",
+			words:   map[string]int{"it's": 1},
+			bigrams: map[string]int{"it": 1},
+		},
+		{
+			name:    "abbreviation",
+			input:   "e.g. so",
+			words:   map[string]int{"e.g": 1, "so": 1},
+			bigrams: map[string]int{"so": 1},
+			ngrams:  map[string]int{"e.g so": 1},
+		},
+		{
+			name:     "decimal and grouped numbers",
+			input:    "3.14 or 1,000",
+			words:    map[string]int{"3.14": 1, "or": 1, "1,000": 1},
+			bigrams:  map[string]int{"14": 1, "or": 1, "00": 2},
+			trigrams: map[string]int{"000": 1},
+			ngrams:   map[string]int{"3.14 or": 1, "or 1,000": 1},
+		},
+		{
+			name:    "separators that do not join",
+			input:   "ab, cd. x,y 3'4 a.1",
+			words:   map[string]int{"ab": 1, "cd": 1, "x": 1, "y": 1, "3": 1, "4": 1, "a": 1, "1": 1},
+			bigrams: map[string]int{"ab": 1, "cd": 1},
+			ngrams: map[string]int{
+				"ab cd": 1, "cd x": 1, "x y": 1, "y 3": 1, "3 4": 1, "4 a": 1, "a 1": 1,
+			},
+		},
+		{
+			name:     "ideographs",
+			input:    "日本語abc",
+			words:    map[string]int{"日": 1, "本": 1, "語": 1, "abc": 1},
+			bigrams:  map[string]int{"ab": 1, "bc": 1},
+			trigrams: map[string]int{"abc": 1},
+			ngrams:   map[string]int{"日 本": 1, "本 語": 1, "語 abc": 1},
+		},
+		{
+			name:      "stop word in an n-gram window",
+			input:     "see the big cat",
+			stopWords: []string{"the"},
+			words:     map[string]int{"see": 1, "big": 1, "cat": 1},
+			bigrams:   map[string]int{"se": 1, "ee": 1, "bi": 1, "ig": 1, "ca": 1, "at": 1},
+			trigrams:  map[string]int{"see": 1, "big": 1, "cat": 1},
+			ngrams:    map[string]int{"big cat": 1},
+			stopped:   1,
+		},
+		{
+			name:   "trigrams",
+			input:  "a b c d",
+			ngram:  3,
+			words:  map[string]int{"a": 1, "b": 1, "c": 1, "d": 1},
+			ngrams: map[string]int{"a b c": 1, "b c d": 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &wordOptions{stopWords: make(map[string]bool), ngram: max(tt.ngram, 2)}
+			for _, word := range tt.stopWords {
+				opts.stopWords[word] = true
+			}
+			w := newWordCounts(opts)
+			for _, r := range tt.input {
+				w.feed(r)
+			}
+			w.endWord()
+
+			for _, table := range []struct {
+				name      string
+				got, want map[string]int
+			}{
+				{"words", w.words, tt.words},
+				{"bigrams", w.bigrams, tt.bigrams},
+				{"trigrams", w.trigrams, tt.trigrams},
+				{"ngrams", w.ngrams, tt.ngrams},
+			} {
+				if !maps.Equal(table.got, table.want) {
+					t.Errorf("%s of %q = %v, want %v", table.name, tt.input, table.got, table.want)
+				}
+			}
+			if total := len(tt.words); w.total != total || w.stopped != tt.stopped {
+				t.Errorf("total, stopped = %d, %d, want %d, %d", w.total, w.stopped, total, tt.stopped)
+			}
+		})
+	}
+}
+
+func TestJoins(t *testing.T) {
+	tests := []struct {
+		before, mid, after rune
+		want               bool
+	}{
+		{'n', '\'', 't', true},
+		{'n', '’', 't', true},
+		{'e', '.', 'g', true},
+		{'3', '.', '1', true},
+		{'1', ',', '0', true},
+		{'a', ',', 'b', false},
+		{'3', '\'', '4', false},
+		{'a', '.', '1', false},
+		{'3', '.', 'a', false},
+		{'é', '\'', 'a', true},
+	}
+
+	for _, tt := range tests {
+		if got := joins(tt.before, tt.mid, tt.after); got != tt.want {
+			t.Errorf("joins(%q, %q, %q) = %t, want %t", tt.before, tt.mid, tt.after, got, tt.want)
+		}
+	}
+}